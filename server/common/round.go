@@ -1,5 +1,10 @@
 package common
 
+import (
+	"fmt"
+	"strings"
+)
+
 type Round int
 
 func (r Round) String() string {
@@ -24,3 +29,13 @@ const (
 	OWARI
 	TIEBREAKER
 )
+
+// ParseRound returns the round named name, as returned by Round.String.
+func ParseRound(name string) (Round, error) {
+	for _, r := range []Round{DAIICHI, DAINI, OWARI, TIEBREAKER} {
+		if strings.EqualFold(name, r.String()) {
+			return r, nil
+		}
+	}
+	return UNKNOWN, fmt.Errorf("unknown round %q", name)
+}
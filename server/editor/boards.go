@@ -0,0 +1,409 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/baconstrip/kiken/common"
+	"github.com/baconstrip/kiken/game"
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/question"
+)
+
+// errEditConflict is returned when an editor tries to change a clue or
+// category that someone else has changed since they last saw it.
+var errEditConflict = errors.New("someone else changed that first, check the latest version and try again")
+
+const (
+	// maxCategories is the most categories a round's board can have, as many
+	// as a show is opened with.
+	maxCategories = 6
+	// cluesPerCategory is how many clues each category needs to be played.
+	cluesPerCategory = 5
+)
+
+// editableRound returns the round named name, which must be one whose
+// categories can be edited.
+func editableRound(name string) (common.Round, error) {
+	switch strings.ToLower(name) {
+	case common.DAIICHI.String():
+		return common.DAIICHI, nil
+	case common.DAINI.String():
+		return common.DAINI, nil
+	default:
+		return common.UNKNOWN, fmt.Errorf("categories can't be edited in round %q", name)
+	}
+}
+
+// board returns the show's board for round, adding an empty one if the show
+// doesn't have it yet.
+func (s *Show) board(round common.Round) *game.Board {
+	for _, b := range s.Rounds {
+		if b.Round == round {
+			return b
+		}
+	}
+	b := game.NewBoard(round)
+	s.Rounds = append(s.Rounds, b)
+	return b
+}
+
+// category returns the category at index i of the board for the round named
+// roundName.
+func (s *Show) category(roundName string, i int) (*question.Category, error) {
+	round, err := editableRound(roundName)
+	if err != nil {
+		return nil, err
+	}
+	b := s.board(round)
+	if i < 0 || i >= len(b.Categories) {
+		return nil, fmt.Errorf("no category %v in round %v", i, round)
+	}
+	return b.Categories[i], nil
+}
+
+// namedCategory returns the category at index i of the board for the round
+// named roundName, which must be named name. If it isn't, the categories have
+// changed or moved since the editor saw them, and errEditConflict is returned.
+func (s *Show) namedCategory(roundName string, i int, name string) (*question.Category, error) {
+	c, err := s.category(roundName, i)
+	if err != nil {
+		return nil, err
+	}
+	if c.Name != name {
+		return nil, errEditConflict
+	}
+	return c, nil
+}
+
+// clue returns the clue at index i in the category at index cat of the board
+// for the round named roundName, which must have the given ID and revision. If
+// it doesn't, the clue has changed or moved since the editor saw it, and
+// errEditConflict is returned.
+func (s *Show) clue(roundName string, cat, i int, id string, revision int) (*question.Category, *question.Question, error) {
+	c, err := s.category(roundName, cat)
+	if err != nil {
+		return nil, nil, err
+	}
+	if i < 0 || i >= len(c.Questions) {
+		return nil, nil, fmt.Errorf("no clue %v in category %q", i, c.Name)
+	}
+	q := c.Questions[i]
+	if q.ID != id || s.revision(q) != revision {
+		return nil, nil, errEditConflict
+	}
+	return c, q, nil
+}
+
+// revision returns the number of changes made to q since the show was opened.
+func (s *Show) revision(q *question.Question) int {
+	return s.revisions[q]
+}
+
+// changed records a change to q.
+func (s *Show) changed(q *question.Question) {
+	if s.revisions == nil {
+		s.revisions = make(map[*question.Question]int)
+	}
+	s.revisions[q]++
+}
+
+// checkCategoryName returns an error if name can't be given to a category,
+// because it's empty or another category in the show already has it.
+// Questions are grouped by category name when a show is opened, so names must
+// be unique.
+func (s *Show) checkCategoryName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("categories must have a name")
+	}
+	for _, b := range s.Rounds {
+		for _, c := range b.Categories {
+			if c.Name == name {
+				return fmt.Errorf("there's already a category named %q", name)
+			}
+		}
+	}
+	return nil
+}
+
+// AddCategory adds an empty category named name to the end of the board for
+// the round named roundName.
+func (s *Show) AddCategory(roundName, name string) error {
+	round, err := editableRound(roundName)
+	if err != nil {
+		return err
+	}
+	if err := s.checkCategoryName(name); err != nil {
+		return err
+	}
+	b := s.board(round)
+	if len(b.Categories) >= maxCategories {
+		return fmt.Errorf("round %v already has %v categories", round, maxCategories)
+	}
+	b.Categories = append(b.Categories, &question.Category{Name: name, Round: round})
+	return nil
+}
+
+// RenameCategory renames the category at index i of the board for the round
+// named roundName, and the clues in it. current must be the category's name
+// as the editor last saw it.
+func (s *Show) RenameCategory(roundName string, i int, current, name string) error {
+	c, err := s.namedCategory(roundName, i, current)
+	if err != nil {
+		return err
+	}
+	if c.Name == name {
+		return nil
+	}
+	if err := s.checkCategoryName(name); err != nil {
+		return err
+	}
+	c.Name = name
+	for _, q := range c.Questions {
+		q.Category = name
+		q.ID = question.NewID(q.Question, name)
+		s.changed(q)
+	}
+	return nil
+}
+
+// SetCategoryComment replaces the comment on the category at index i of the
+// board for the round named roundName. current must be the category's name as
+// the editor last saw it.
+func (s *Show) SetCategoryComment(roundName string, i int, current, comment string) error {
+	c, err := s.namedCategory(roundName, i, current)
+	if err != nil {
+		return err
+	}
+	c.Comment = comment
+	return nil
+}
+
+// SetInfo replaces the show's title, author and notes. An empty title is
+// replaced with the show's name.
+func (s *Show) SetInfo(title, author, notes string) error {
+	if strings.TrimSpace(title) == "" {
+		title = s.name
+	}
+	s.title = title
+	s.author = author
+	s.notes = notes
+	return nil
+}
+
+// DeleteCategory removes the category at index i of the board for the round
+// named roundName. current must be the category's name as the editor last saw
+// it.
+func (s *Show) DeleteCategory(roundName string, i int, current string) error {
+	c, err := s.namedCategory(roundName, i, current)
+	if err != nil {
+		return err
+	}
+	b := s.board(c.Round)
+	b.Categories = append(b.Categories[:i], b.Categories[i+1:]...)
+	return nil
+}
+
+// MoveCategory moves the category at index i of the board for the round named
+// roundName to index to. current must be the category's name as the editor
+// last saw it.
+func (s *Show) MoveCategory(roundName string, i int, current string, to int) error {
+	c, err := s.namedCategory(roundName, i, current)
+	if err != nil {
+		return err
+	}
+	b := s.board(c.Round)
+	if to < 0 || to >= len(b.Categories) {
+		return fmt.Errorf("can't move category to %v in round %v", to, c.Round)
+	}
+	b.Categories = append(b.Categories[:i], b.Categories[i+1:]...)
+	b.Categories = append(b.Categories[:to], append([]*question.Category{c}, b.Categories[to:]...)...)
+	return nil
+}
+
+// checkClue returns an error if a clue can't be given value, prompt and
+// answer.
+func checkClue(value int, prompt, answer string) error {
+	if value < 0 {
+		return fmt.Errorf("clues can't have a negative value")
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return fmt.Errorf("clues must have a question")
+	}
+	if strings.TrimSpace(answer) == "" {
+		return fmt.Errorf("clues must have an answer")
+	}
+	return nil
+}
+
+// AddClue adds a clue to the category at index cat of the board for the round
+// named roundName, keeping the category's clues in order of value. current
+// must be the category's name as the editor last saw it.
+func (s *Show) AddClue(roundName string, cat int, current string, value int, prompt, answer string) error {
+	c, err := s.namedCategory(roundName, cat, current)
+	if err != nil {
+		return err
+	}
+	if err := checkClue(value, prompt, answer); err != nil {
+		return err
+	}
+	q := &question.Question{
+		Category: c.Name,
+		Value:    value,
+		Question: prompt,
+		Answer:   answer,
+		Round:    c.Round,
+		ID:       question.NewID(prompt, c.Name),
+	}
+	c.Questions = append(c.Questions, q)
+	s.changed(q)
+	sortClues(c)
+	return nil
+}
+
+// EditClue replaces the value, question and answer of the clue at index i in
+// the category at index cat of the board for the round named roundName, which
+// must have the given ID and revision.
+func (s *Show) EditClue(roundName string, cat, i int, id string, revision, value int, prompt, answer string) error {
+	c, q, err := s.clue(roundName, cat, i, id, revision)
+	if err != nil {
+		return err
+	}
+	if err := checkClue(value, prompt, answer); err != nil {
+		return err
+	}
+	q.Value = value
+	q.Question = prompt
+	q.Answer = answer
+	q.ID = question.NewID(prompt, c.Name)
+	s.changed(q)
+	sortClues(c)
+	return nil
+}
+
+// DeleteClue removes the clue at index i in the category at index cat of the
+// board for the round named roundName, which must have the given ID and
+// revision.
+func (s *Show) DeleteClue(roundName string, cat, i int, id string, revision int) error {
+	c, q, err := s.clue(roundName, cat, i, id, revision)
+	if err != nil {
+		return err
+	}
+	c.Questions = append(c.Questions[:i], c.Questions[i+1:]...)
+	delete(s.revisions, q)
+	return nil
+}
+
+// sortClues puts the clues in a category in order of value, as they're played.
+func sortClues(c *question.Category) {
+	sort.Stable(question.ByValue(c.Questions))
+}
+
+// SetOwari replaces the show's Owari clue with one in category. If the show
+// already has an Owari clue it must have the given ID and revision, and if it
+// doesn't id must be empty, or errEditConflict is returned.
+func (s *Show) SetOwari(id string, revision int, category, prompt, answer string) error {
+	if strings.TrimSpace(category) == "" {
+		return fmt.Errorf("the Owari clue must have a category")
+	}
+	if err := checkClue(0, prompt, answer); err != nil {
+		return err
+	}
+	b := s.board(common.OWARI)
+	var q *question.Question
+	if len(b.Categories) > 0 && len(b.Categories[0].Questions) > 0 {
+		q = b.Categories[0].Questions[0]
+	}
+	if q == nil {
+		if id != "" {
+			return errEditConflict
+		}
+		q = &question.Question{Round: common.OWARI}
+	} else if q.ID != id || s.revision(q) != revision {
+		return errEditConflict
+	}
+	q.Category = category
+	q.Question = prompt
+	q.Answer = answer
+	q.ID = question.NewID(prompt, category)
+	b.Categories = []*question.Category{{
+		Name:      category,
+		Round:     common.OWARI,
+		Questions: []*question.Question{q},
+	}}
+	s.changed(q)
+	return nil
+}
+
+// Validate returns the problems that stop the show being played as a full
+// game: the daiichi and daini rounds each need maxCategories categories of
+// cluesPerCategory clues, worth the values for the round, and the show needs
+// an Owari clue.
+func (s *Show) Validate() []error {
+	var problems []error
+	for _, round := range []common.Round{common.DAIICHI, common.DAINI} {
+		var categories []*question.Category
+		for _, b := range s.Rounds {
+			if b.Round == round {
+				categories = b.Categories
+			}
+		}
+		if len(categories) != maxCategories {
+			problems = append(problems, fmt.Errorf("round %v has %v categories, it needs %v", round, len(categories), maxCategories))
+		}
+
+		want := question.RoundValues(round)
+		for _, c := range categories {
+			if len(c.Questions) != cluesPerCategory {
+				problems = append(problems, fmt.Errorf("category %q has %v clues, it needs %v", c.Name, len(c.Questions), cluesPerCategory))
+				continue
+			}
+			var values []int
+			for _, q := range c.Questions {
+				values = append(values, q.Value)
+			}
+			sort.Ints(values)
+			if !reflect.DeepEqual(values, want) {
+				problems = append(problems, fmt.Errorf("category %q has clues worth %v, in round %v they should be worth %v", c.Name, values, round, want))
+			}
+		}
+	}
+	if err := s.Playable(); err != nil {
+		problems = append(problems, err)
+	}
+	return problems
+}
+
+// Boards returns the message sent to editors with the show's boards.
+func (s *Show) Boards() *message.UpdateEditorBoards {
+	update := &message.UpdateEditorBoards{
+		ShowID:   s.id,
+		Name:     s.name,
+		Title:    s.title,
+		Author:   s.author,
+		Notes:    s.notes,
+		Created:  s.created.Unix(),
+		Modified: s.modified.Unix(),
+	}
+	for _, b := range s.Rounds {
+		board := &message.EditorBoard{Round: b.Round.String()}
+		for _, c := range b.Categories {
+			category := &message.EditorCategory{Name: c.Name, Comment: c.Comment}
+			for _, q := range c.Questions {
+				category.Clues = append(category.Clues, &message.EditorClue{
+					ID:       q.ID,
+					Revision: s.revision(q),
+					Value:    q.Value,
+					Question: q.Question,
+					Answer:   q.Answer,
+				})
+			}
+			board.Categories = append(board.Categories, category)
+		}
+		update.Rounds = append(update.Rounds, board)
+	}
+	return update
+}
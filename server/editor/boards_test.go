@@ -0,0 +1,252 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/baconstrip/kiken/common"
+	"github.com/baconstrip/kiken/question"
+)
+
+// clueVersion returns the ID and revision an editor would have seen for the
+// clue at index i in the category at index cat of round's board.
+func clueVersion(s *Show, round common.Round, cat, i int) (string, int) {
+	q := s.board(round).Categories[cat].Questions[i]
+	return q.ID, s.revision(q)
+}
+
+func TestEditedShowReopens(t *testing.T) {
+	DataDir = t.TempDir()
+	s := NewShow("test")
+
+	for _, c := range []string{"first", "second", "third"} {
+		if err := s.AddCategory("daiichi", c); err != nil {
+			t.Fatalf("AddCategory(%q) failed: %v", c, err)
+		}
+		for _, v := range []int{400, 200} {
+			if err := s.AddClue("daiichi", len(s.board(common.DAIICHI).Categories)-1, c, v, c+" question", c+" answer"); err != nil {
+				t.Fatalf("AddClue() failed: %v", err)
+			}
+		}
+	}
+	if err := s.AddCategory("daiichi", "second"); err == nil {
+		t.Errorf("AddCategory() with a duplicate name succeeded")
+	}
+	if err := s.AddCategory("owari", "last"); err == nil {
+		t.Errorf("AddCategory() to the owari round succeeded")
+	}
+	if err := s.MoveCategory("daiichi", 2, "third", 0); err != nil {
+		t.Fatalf("MoveCategory() failed: %v", err)
+	}
+	if err := s.RenameCategory("daiichi", 1, "first", "renamed"); err != nil {
+		t.Fatalf("RenameCategory() failed: %v", err)
+	}
+	id, rev := clueVersion(s, common.DAIICHI, 0, 0)
+	if err := s.EditClue("daiichi", 0, 0, id, rev, 1000, "edited", "answer"); err != nil {
+		t.Fatalf("EditClue() failed: %v", err)
+	}
+	id, rev = clueVersion(s, common.DAIICHI, 2, 0)
+	if err := s.DeleteClue("daiichi", 2, 0, id, rev); err != nil {
+		t.Fatalf("DeleteClue() failed: %v", err)
+	}
+	if err := s.DeleteClue("daiichi", 2, 5, id, rev); err == nil {
+		t.Errorf("DeleteClue() of a missing clue succeeded")
+	}
+	if err := s.SetOwari("", 0, "final", "owari question", "owari answer"); err != nil {
+		t.Fatalf("SetOwari() failed: %v", err)
+	}
+
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	opened, err := OpenShow(filepath.Join(DataDir, "test.json"))
+	if err != nil {
+		t.Fatalf("OpenShow() failed: %v", err)
+	}
+
+	board := opened.Boards()
+	want := []struct {
+		name   string
+		values []int
+	}{
+		{"third", []int{400, 1000}},
+		{"renamed", []int{200, 400}},
+		{"second", []int{400}},
+	}
+	got := board.Rounds[0].Categories
+	if len(got) != len(want) {
+		t.Fatalf("reopened show has %v categories, want %v", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].Name != w.name {
+			t.Errorf("category %v is %q, want %q", i, got[i].Name, w.name)
+			continue
+		}
+		if len(got[i].Clues) != len(w.values) {
+			t.Errorf("category %q has %v clues, want %v", w.name, len(got[i].Clues), len(w.values))
+			continue
+		}
+		for j, v := range w.values {
+			if got[i].Clues[j].Value != v {
+				t.Errorf("clue %v of %q has value %v, want %v", j, w.name, got[i].Clues[j].Value, v)
+			}
+		}
+	}
+	if owari := board.Rounds[2].Categories; len(owari) != 1 || owari[0].Name != "final" {
+		t.Errorf("reopened show's owari round = %+v, want the category final", owari)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	DataDir = t.TempDir()
+	s := NewShow("test")
+	if problems := s.Validate(); len(problems) != 3 {
+		t.Errorf("Validate() of an empty show = %v, want 3 problems", problems)
+	}
+
+	for _, round := range []common.Round{common.DAIICHI, common.DAINI} {
+		for i := 0; i < maxCategories; i++ {
+			name := fmt.Sprintf("%v %v", round, i)
+			if err := s.AddCategory(round.String(), name); err != nil {
+				t.Fatalf("AddCategory() failed: %v", err)
+			}
+			for _, v := range question.RoundValues(round) {
+				if err := s.AddClue(round.String(), i, name, v, name+" question", "answer"); err != nil {
+					t.Fatalf("AddClue() failed: %v", err)
+				}
+			}
+		}
+	}
+	if err := s.SetOwari("", 0, "final", "question", "answer"); err != nil {
+		t.Fatalf("SetOwari() failed: %v", err)
+	}
+	if problems := s.Validate(); len(problems) != 0 {
+		t.Errorf("Validate() of a full show = %v, want no problems", problems)
+	}
+
+	id, rev := clueVersion(s, common.DAINI, 0, 0)
+	if err := s.EditClue("daini", 0, 0, id, rev, 200, "question", "answer"); err != nil {
+		t.Fatalf("EditClue() failed: %v", err)
+	}
+	id, rev = clueVersion(s, common.DAIICHI, 0, 0)
+	if err := s.DeleteClue("daiichi", 0, 0, id, rev); err != nil {
+		t.Fatalf("DeleteClue() failed: %v", err)
+	}
+	if problems := s.Validate(); len(problems) != 2 {
+		t.Errorf("Validate() with a wrong value and a missing clue = %v, want 2 problems", problems)
+	}
+}
+
+func TestEditConflict(t *testing.T) {
+	DataDir = t.TempDir()
+	s := NewShow("test")
+	if err := s.AddCategory("daiichi", "first"); err != nil {
+		t.Fatalf("AddCategory() failed: %v", err)
+	}
+	for _, v := range []int{200, 400} {
+		if err := s.AddClue("daiichi", 0, "first", v, "question", "answer"); err != nil {
+			t.Fatalf("AddClue() failed: %v", err)
+		}
+	}
+
+	// Two editors see the same version of the first clue, and both edit it.
+	id, rev := clueVersion(s, common.DAIICHI, 0, 0)
+	if err := s.EditClue("daiichi", 0, 0, id, rev, 200, "first edit", "answer"); err != nil {
+		t.Fatalf("EditClue() failed: %v", err)
+	}
+	if err := s.EditClue("daiichi", 0, 0, id, rev, 200, "second edit", "answer"); !errors.Is(err, errEditConflict) {
+		t.Errorf("EditClue() of a stale clue = %v, want %v", err, errEditConflict)
+	}
+	if err := s.DeleteClue("daiichi", 0, 0, id, rev); !errors.Is(err, errEditConflict) {
+		t.Errorf("DeleteClue() of a stale clue = %v, want %v", err, errEditConflict)
+	}
+	if got := s.board(common.DAIICHI).Categories[0].Questions[0].Question; got != "first edit" {
+		t.Errorf("clue's question is %q after a rejected edit, want %q", got, "first edit")
+	}
+
+	// Once the first clue is deleted, the second takes its index, but an edit
+	// meant for the first mustn't change it.
+	id, rev = clueVersion(s, common.DAIICHI, 0, 0)
+	if err := s.DeleteClue("daiichi", 0, 0, id, rev); err != nil {
+		t.Fatalf("DeleteClue() failed: %v", err)
+	}
+	if err := s.EditClue("daiichi", 0, 0, id, rev, 200, "third edit", "answer"); !errors.Is(err, errEditConflict) {
+		t.Errorf("EditClue() of a deleted clue = %v, want %v", err, errEditConflict)
+	}
+}
+
+func TestCategoryEditConflict(t *testing.T) {
+	DataDir = t.TempDir()
+	s := NewShow("test")
+	for _, c := range []string{"first", "second", "third"} {
+		if err := s.AddCategory("daiichi", c); err != nil {
+			t.Fatalf("AddCategory(%q) failed: %v", c, err)
+		}
+	}
+
+	// Two editors see the same board, and both delete the first category.
+	// Once it's gone the second takes its index, but mustn't be deleted too.
+	if err := s.DeleteCategory("daiichi", 0, "first"); err != nil {
+		t.Fatalf("DeleteCategory() failed: %v", err)
+	}
+	if err := s.DeleteCategory("daiichi", 0, "first"); !errors.Is(err, errEditConflict) {
+		t.Errorf("DeleteCategory() of a stale category = %v, want %v", err, errEditConflict)
+	}
+	if err := s.RenameCategory("daiichi", 0, "first", "renamed"); !errors.Is(err, errEditConflict) {
+		t.Errorf("RenameCategory() of a stale category = %v, want %v", err, errEditConflict)
+	}
+	if err := s.MoveCategory("daiichi", 0, "first", 1); !errors.Is(err, errEditConflict) {
+		t.Errorf("MoveCategory() of a stale category = %v, want %v", err, errEditConflict)
+	}
+	if err := s.SetCategoryComment("daiichi", 0, "first", "comment"); !errors.Is(err, errEditConflict) {
+		t.Errorf("SetCategoryComment() of a stale category = %v, want %v", err, errEditConflict)
+	}
+	if err := s.AddClue("daiichi", 0, "first", 200, "question", "answer"); !errors.Is(err, errEditConflict) {
+		t.Errorf("AddClue() to a stale category = %v, want %v", err, errEditConflict)
+	}
+	if c := s.board(common.DAIICHI).Categories[0]; c.Comment != "" || len(c.Questions) != 0 {
+		t.Errorf("category %q after rejected changes has comment %q and %v clues, want none", c.Name, c.Comment, len(c.Questions))
+	}
+
+	var names []string
+	for _, c := range s.board(common.DAIICHI).Categories {
+		names = append(names, c.Name)
+	}
+	if fmt.Sprint(names) != "[second third]" {
+		t.Errorf("categories after rejected changes = %v, want [second third]", names)
+	}
+}
+
+func TestOwariEditConflict(t *testing.T) {
+	DataDir = t.TempDir()
+	s := NewShow("test")
+	if err := s.SetOwari("stale", 0, "final", "question", "answer"); !errors.Is(err, errEditConflict) {
+		t.Errorf("SetOwari() with an ID before there's a clue = %v, want %v", err, errEditConflict)
+	}
+	if err := s.SetOwari("", 0, "final", "question", "answer"); err != nil {
+		t.Fatalf("SetOwari() failed: %v", err)
+	}
+	id, rev := clueVersion(s, common.OWARI, 0, 0)
+
+	// Two editors see the same clue and both change it. The second must be
+	// told the clue changed rather than overwrite the first's change.
+	if err := s.SetOwari(id, rev, "final", "first question", "answer"); err != nil {
+		t.Fatalf("SetOwari() failed: %v", err)
+	}
+	if err := s.SetOwari(id, rev, "final", "second question", "answer"); !errors.Is(err, errEditConflict) {
+		t.Errorf("SetOwari() of a stale clue = %v, want %v", err, errEditConflict)
+	}
+	if err := s.SetOwari("", 0, "final", "second question", "answer"); !errors.Is(err, errEditConflict) {
+		t.Errorf("SetOwari() without an ID once there's a clue = %v, want %v", err, errEditConflict)
+	}
+	if q := s.board(common.OWARI).Categories[0].Questions[0]; q.Question != "first question" {
+		t.Errorf("Owari question after a rejected change = %q, want %q", q.Question, "first question")
+	}
+
+	id, rev = clueVersion(s, common.OWARI, 0, 0)
+	if err := s.SetOwari(id, rev, "final", "second question", "answer"); err != nil {
+		t.Errorf("SetOwari() of the latest clue failed: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package editor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/baconstrip/kiken/common"
+	"github.com/baconstrip/kiken/question"
+)
+
+// showDocumentVersion is the version of the show document format that Save
+// writes. Documents from a newer version are refused rather than misread.
+const showDocumentVersion = 1
+
+// ShowDocument is a show as saved to disk. Unlike the legacy format, a flat
+// list of questions, it keeps the order of the rounds and categories, and
+// categories that don't have clues yet.
+type ShowDocument struct {
+	Version  int
+	Title    string
+	Author   string
+	Notes    string
+	Created  time.Time
+	Modified time.Time
+	Rounds   []ShowDocumentRound
+}
+
+// ShowDocumentRound is the board of one round in a ShowDocument.
+type ShowDocumentRound struct {
+	Round      string
+	Categories []ShowDocumentCategory
+}
+
+// ShowDocumentCategory is a category in a ShowDocument, with its clues in
+// order.
+type ShowDocumentCategory struct {
+	Name    string
+	Comment string `json:",omitempty"`
+	Clues   []ShowDocumentClue
+}
+
+// ShowDocumentClue is a clue in a ShowDocument.
+type ShowDocumentClue struct {
+	Value    int
+	Question string
+	Answer   string
+	Showing  int `json:",omitempty"`
+}
+
+// isLegacyShow returns whether data is a show in the legacy format, a flat
+// JSON array of questions, rather than a ShowDocument.
+func isLegacyShow(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("["))
+}
+
+// document returns the show as it's saved to disk.
+func (s *Show) document() ShowDocument {
+	doc := ShowDocument{
+		Version:  showDocumentVersion,
+		Title:    s.title,
+		Author:   s.author,
+		Notes:    s.notes,
+		Created:  s.created,
+		Modified: s.modified,
+	}
+	for _, b := range s.Rounds {
+		round := ShowDocumentRound{Round: b.Round.String()}
+		for _, c := range b.Categories {
+			category := ShowDocumentCategory{Name: c.Name, Comment: c.Comment}
+			for _, q := range c.Questions {
+				clue := ShowDocumentClue{
+					Value:    q.Value,
+					Question: q.Question,
+					Answer:   q.Answer,
+				}
+				if q.Showing > 0 {
+					clue.Showing = q.Showing
+				}
+				category.Clues = append(category.Clues, clue)
+			}
+			round.Categories = append(round.Categories, category)
+		}
+		doc.Rounds = append(doc.Rounds, round)
+	}
+	return doc
+}
+
+// decodeShowDocument makes a show from a saved ShowDocument.
+func decodeShowDocument(data []byte) (*Show, error) {
+	var doc ShowDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("could not decode show: %v", err)
+	}
+	if doc.Version < 1 {
+		return nil, fmt.Errorf("show has no version, it may not be a show")
+	}
+	if doc.Version > showDocumentVersion {
+		return nil, fmt.Errorf("show was saved in version %v of the format, this server only reads up to version %v", doc.Version, showDocumentVersion)
+	}
+
+	s := &Show{
+		title:    doc.Title,
+		author:   doc.Author,
+		notes:    doc.Notes,
+		created:  doc.Created,
+		modified: doc.Modified,
+	}
+	for _, r := range doc.Rounds {
+		round, err := common.ParseRound(r.Round)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode show: %v", err)
+		}
+		b := s.board(round)
+		for _, c := range r.Categories {
+			category := &question.Category{Name: c.Name, Round: round, Comment: c.Comment}
+			for _, clue := range c.Clues {
+				category.Questions = append(category.Questions, &question.Question{
+					Category: c.Name,
+					Value:    clue.Value,
+					Question: clue.Question,
+					Answer:   clue.Answer,
+					Round:    round,
+					Showing:  clue.Showing,
+					ID:       question.NewID(clue.Question, c.Name),
+				})
+			}
+			b.Categories = append(b.Categories, category)
+		}
+	}
+
+	// Every show has the standard rounds, in the order they're played.
+	for _, round := range []common.Round{common.DAIICHI, common.DAINI, common.OWARI} {
+		s.board(round)
+	}
+	sort.SliceStable(s.Rounds, func(i, j int) bool { return s.Rounds[i].Round < s.Rounds[j].Round })
+	return s, nil
+}
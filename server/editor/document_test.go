@@ -0,0 +1,108 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/baconstrip/kiken/common"
+)
+
+func TestShowDocumentRoundTrip(t *testing.T) {
+	DataDir = t.TempDir()
+	s := NewShow("doc")
+	if err := s.SetInfo("A Show", "someone", "some notes"); err != nil {
+		t.Fatalf("SetInfo() failed: %v", err)
+	}
+	for _, name := range []string{"empty", "full"} {
+		if err := s.AddCategory("daini", name); err != nil {
+			t.Fatalf("AddCategory() failed: %v", err)
+		}
+	}
+	if err := s.SetCategoryComment("daini", 1, "full", "check the spelling"); err != nil {
+		t.Fatalf("SetCategoryComment() failed: %v", err)
+	}
+	if err := s.AddClue("daini", 1, "full", 400, "question", "answer"); err != nil {
+		t.Fatalf("AddClue() failed: %v", err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	opened, err := OpenShow(filepath.Join(DataDir, "doc.json"))
+	if err != nil {
+		t.Fatalf("OpenShow() failed: %v", err)
+	}
+	if opened.title != "A Show" || opened.author != "someone" || opened.notes != "some notes" {
+		t.Errorf("reopened show's info = %q, %q, %q, want the info that was set", opened.title, opened.author, opened.notes)
+	}
+	if !opened.created.Equal(s.created) || !opened.modified.Equal(s.modified) {
+		t.Errorf("reopened show's timestamps = %v, %v, want %v, %v", opened.created, opened.modified, s.created, s.modified)
+	}
+
+	categories := opened.board(common.DAINI).Categories
+	if len(categories) != 2 || categories[0].Name != "empty" || categories[1].Name != "full" {
+		t.Fatalf("reopened show's daini categories = %+v, want empty then full", categories)
+	}
+	if len(categories[0].Questions) != 0 {
+		t.Errorf("category empty has %v clues, want none", len(categories[0].Questions))
+	}
+	if c := categories[1]; c.Comment != "check the spelling" || len(c.Questions) != 1 || c.Questions[0].Value != 400 {
+		t.Errorf("category full = %+v, want its comment and clue", c)
+	}
+	if len(opened.Rounds) != 3 || opened.Rounds[0].Round != common.DAIICHI || opened.Rounds[2].Round != common.OWARI {
+		t.Errorf("reopened show's rounds are out of order")
+	}
+}
+
+func TestOpenLegacyShow(t *testing.T) {
+	DataDir = t.TempDir()
+	legacy := `[
+		{"category": "cat", "value": "$200", "question": "q1", "answer": "a1", "round": "daiichi"},
+		{"category": "cat", "value": "$400", "question": "q2", "answer": "a2", "round": "daiichi"},
+		{"category": "last", "value": 0, "question": "q3", "answer": "a3", "round": "owari"}
+	]`
+	p := filepath.Join(DataDir, "legacy.json")
+	if err := os.WriteFile(p, []byte(legacy), 0o644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	s, err := OpenShow(p)
+	if err != nil {
+		t.Fatalf("OpenShow() of a legacy show failed: %v", err)
+	}
+	if s.title != "legacy" {
+		t.Errorf("legacy show's title = %q, want its name", s.title)
+	}
+	if c := s.board(common.DAIICHI).Categories; len(c) != 1 || len(c[0].Questions) != 2 {
+		t.Errorf("legacy show's daiichi categories = %+v, want one of two clues", c)
+	}
+	if err := s.Playable(); err != nil {
+		t.Errorf("Playable() of legacy show = %v", err)
+	}
+
+	// Saving converts it to a document, which opens the same.
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	if isLegacyShow(data) {
+		t.Errorf("saved show is still in the legacy format")
+	}
+	if _, err := OpenShow(p); err != nil {
+		t.Errorf("OpenShow() of converted show failed: %v", err)
+	}
+}
+
+func TestOpenNewerShowDocument(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "future.json")
+	if err := os.WriteFile(p, []byte(`{"Version": 99, "Rounds": []}`), 0o644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	if _, err := OpenShow(p); err == nil {
+		t.Errorf("OpenShow() of a document from a newer version succeeded")
+	}
+}
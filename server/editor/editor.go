@@ -1,12 +1,11 @@
 package editor
 
 import (
-	"crypto/sha512"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
 	"path"
+	"strings"
 	"sync"
 
 	"github.com/baconstrip/kiken/message"
@@ -27,9 +26,14 @@ type EditorDriver struct {
 
 	// Contains a mapping between show IDs and the full filename for a show
 	knownShows map[string]string
+
+	// openShows contains the shows that editors have open, by ID.
+	openShows map[string]*Show
 }
 
 type EditorSession struct {
+	// currentShow is the show the editor has open, nil until they select
+	// one.
 	currentShow *Show
 }
 
@@ -38,44 +42,63 @@ func NewEditorDriver(s *server.Server, editorListener *server.ListenerManager) *
 		mu:             &sync.RWMutex{},
 		server:         s,
 		sessions:       make(map[string]*EditorSession),
+		openShows:      make(map[string]*Show),
 		editorListener: editorListener,
 	}
 }
 
 func (e *EditorDriver) Start() {
 	e.editorListener.RegisterJoin(e.onJoinManageEditor)
-	e.editorListener.RegisterMessage("RequestShow", e.onRequestShowPresentShows)
+	e.editorListener.RegisterLeave(e.onLeaveManageEditor)
+	e.editorListener.RegisterMessage("RequestShows", e.onRequestShowPresentShows)
 	e.editorListener.RegisterMessage("SelectShow", e.onSelectShowActivateShow)
+	e.editorListener.RegisterMessage("CreateShow", e.onCreateShowCreate)
+	e.editorListener.RegisterMessage("RenameShow", e.onRenameShowRename)
+	e.editorListener.RegisterMessage("DuplicateShow", e.onDuplicateShowDuplicate)
+	e.editorListener.RegisterMessage("DeleteShow", e.onDeleteShowDelete)
+	e.editorListener.RegisterMessage("SetShowInfo", e.onSetShowInfoEdit)
+	e.editorListener.RegisterMessage("SetCategoryComment", e.onSetCategoryCommentEdit)
+	e.editorListener.RegisterMessage("AddCategory", e.onAddCategoryEdit)
+	e.editorListener.RegisterMessage("RenameCategory", e.onRenameCategoryEdit)
+	e.editorListener.RegisterMessage("DeleteCategory", e.onDeleteCategoryEdit)
+	e.editorListener.RegisterMessage("MoveCategory", e.onMoveCategoryEdit)
+	e.editorListener.RegisterMessage("AddClue", e.onAddClueEdit)
+	e.editorListener.RegisterMessage("EditClue", e.onEditClueEdit)
+	e.editorListener.RegisterMessage("DeleteClue", e.onDeleteClueEdit)
+	e.editorListener.RegisterMessage("SetOwari", e.onSetOwariEdit)
 
 	e.refreshGamesFromDisk()
 }
 
 func (e *EditorDriver) onRequestShowPresentShows(name string, _ bool, _ message.ClientMessage) error {
-	shows := make(map[string]string)
-
-	for id, f := range e.knownShows {
-		ext := path.Ext(f)
-		cleaned := f[:len(f)-len(ext)]
-
-		shows[id] = cleaned
-	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
-	resp := &message.AvailableShows{
-		Shows: shows,
-	}
+	// Pick up any shows saved since the last request.
+	e.refreshGamesFromDisk()
 
-	e.server.MessageEditor(server.EncodeServerMessage(resp), name)
+	e.server.MessageEditor(server.EncodeServerMessage(e.availableShows()), name)
 	return nil
 }
 
 func (e *EditorDriver) onSelectShowActivateShow(name string, _ bool, msg message.ClientMessage) error {
-	id := msg.Data.(*message.SelectShow).ShowID
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
-	filepath := e.knownShows[id]
+	id := msg.Data.(*message.SelectShow).ShowID
 
-	// show
-	_, err := OpenShow(filepath)
+	f, ok := e.knownShows[id]
+	if !ok {
+		e.sendError(name, 1400, fmt.Errorf("no show with ID %v", id))
+		return nil
+	}
 
+	p, err := showPath(f)
+	if err != nil {
+		e.sendError(name, 1404, err)
+		return nil
+	}
+	show, err := e.openShow(id, p)
 	if err != nil {
 		log.Printf("Failed to open game in editor: %v", err)
 
@@ -84,18 +107,53 @@ func (e *EditorDriver) onSelectShowActivateShow(name string, _ bool, msg message
 			Code:    1400,
 		}
 
-		e.server.MessageEditor(server.EncodeServerMessage(msg), name)
+		e.server.MessageEditor(server.EncodeServerMessage(&msg), name)
 		return errors.New("failed to open game in editor")
 	}
 
+	e.openForEditing(name, show)
 	return nil
 }
 
 func (e *EditorDriver) onJoinManageEditor(name string, _ bool, _ bool) error {
-	//m.sessions[name] = &EditorSession{}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Listeners run concurrently, so the editor may already have opened a
+	// show by the time this runs.
+	e.session(name)
 	return nil
 }
 
+func (e *EditorDriver) onLeaveManageEditor(name string, _ bool, _ bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.setCurrentShow(name, nil)
+	delete(e.sessions, name)
+	return nil
+}
+
+// session returns the editor session for name, creating it if needed.
+// Callers must obtain a mutex before calling.
+func (e *EditorDriver) session(name string) *EditorSession {
+	session, ok := e.sessions[name]
+	if !ok {
+		session = &EditorSession{}
+		e.sessions[name] = session
+	}
+	return session
+}
+
+// sendError shows the editor name an error.
+func (e *EditorDriver) sendError(name string, code int, err error) {
+	msg := message.SetEditorError{
+		Message: err.Error(),
+		Code:    code,
+	}
+	e.server.MessageEditor(server.EncodeServerMessage(&msg), name)
+}
+
 func (e *EditorDriver) refreshGamesFromDisk() []string {
 	files, err := util.GetFilesInDir(DataDir)
 	if err != nil {
@@ -105,13 +163,119 @@ func (e *EditorDriver) refreshGamesFromDisk() []string {
 
 	e.knownShows = make(map[string]string)
 	for _, f := range files {
+		if path.Ext(f) != ".json" {
+			continue
+		}
+		e.knownShows[showID(f)] = f
+	}
+
+	return files
+}
 
-		hasher := sha512.New()
-		hasher.Write([]byte(f))
-		sha := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+// edit makes a change to the show the editor name has open, saves it, and
+// sends the updated boards to every editor with it open. If the change can't be
+// made, they're told why and the show is left as it was. Shows are saved even
+// if they can't be played yet, so that they can be written a clue at a time,
+// but the editor is told what's still missing.
+func (e *EditorDriver) edit(name string, change func(*Show) error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
-		e.knownShows[sha] = f
+	show := e.session(name).currentShow
+	if show == nil {
+		e.sendError(name, 1401, errors.New("no show is open"))
+		return nil
 	}
 
-	return files
+	if err := change(show); err != nil {
+		code := 1402
+		if errors.Is(err, errEditConflict) {
+			code = 1410
+		}
+		e.sendError(name, code, err)
+		return nil
+	}
+	if err := show.Save(); err != nil {
+		log.Printf("Failed to save show edited by %v: %v", name, err)
+		e.sendError(name, 1403, err)
+	} else if problems := show.Validate(); len(problems) > 0 {
+		var msgs []string
+		for _, p := range problems {
+			msgs = append(msgs, p.Error())
+		}
+		e.sendError(name, 1409, fmt.Errorf("saved, but the show can't be played yet: %v", strings.Join(msgs, "; ")))
+	}
+
+	e.sendBoards(show, name)
+	return nil
+}
+
+func (e *EditorDriver) onSetShowInfoEdit(name string, _ bool, msg message.ClientMessage) error {
+	m := msg.Data.(*message.SetShowInfo)
+	return e.edit(name, func(s *Show) error {
+		return s.SetInfo(m.Title, m.Author, m.Notes)
+	})
+}
+
+func (e *EditorDriver) onSetCategoryCommentEdit(name string, _ bool, msg message.ClientMessage) error {
+	m := msg.Data.(*message.SetCategoryComment)
+	return e.edit(name, func(s *Show) error {
+		return s.SetCategoryComment(m.Round, m.Category, m.Current, m.Comment)
+	})
+}
+
+func (e *EditorDriver) onAddCategoryEdit(name string, _ bool, msg message.ClientMessage) error {
+	m := msg.Data.(*message.AddCategory)
+	return e.edit(name, func(s *Show) error {
+		return s.AddCategory(m.Round, m.Name)
+	})
+}
+
+func (e *EditorDriver) onRenameCategoryEdit(name string, _ bool, msg message.ClientMessage) error {
+	m := msg.Data.(*message.RenameCategory)
+	return e.edit(name, func(s *Show) error {
+		return s.RenameCategory(m.Round, m.Category, m.Current, m.Name)
+	})
+}
+
+func (e *EditorDriver) onDeleteCategoryEdit(name string, _ bool, msg message.ClientMessage) error {
+	m := msg.Data.(*message.DeleteCategory)
+	return e.edit(name, func(s *Show) error {
+		return s.DeleteCategory(m.Round, m.Category, m.Current)
+	})
+}
+
+func (e *EditorDriver) onMoveCategoryEdit(name string, _ bool, msg message.ClientMessage) error {
+	m := msg.Data.(*message.MoveCategory)
+	return e.edit(name, func(s *Show) error {
+		return s.MoveCategory(m.Round, m.Category, m.Current, m.To)
+	})
+}
+
+func (e *EditorDriver) onAddClueEdit(name string, _ bool, msg message.ClientMessage) error {
+	m := msg.Data.(*message.AddClue)
+	return e.edit(name, func(s *Show) error {
+		return s.AddClue(m.Round, m.Category, m.Current, m.Value, m.Question, m.Answer)
+	})
+}
+
+func (e *EditorDriver) onEditClueEdit(name string, _ bool, msg message.ClientMessage) error {
+	m := msg.Data.(*message.EditClue)
+	return e.edit(name, func(s *Show) error {
+		return s.EditClue(m.Round, m.Category, m.Clue, m.ID, m.Revision, m.Value, m.Question, m.Answer)
+	})
+}
+
+func (e *EditorDriver) onDeleteClueEdit(name string, _ bool, msg message.ClientMessage) error {
+	m := msg.Data.(*message.DeleteClue)
+	return e.edit(name, func(s *Show) error {
+		return s.DeleteClue(m.Round, m.Category, m.Clue, m.ID, m.Revision)
+	})
+}
+
+func (e *EditorDriver) onSetOwariEdit(name string, _ bool, msg message.ClientMessage) error {
+	m := msg.Data.(*message.SetOwari)
+	return e.edit(name, func(s *Show) error {
+		return s.SetOwari(m.ID, m.Revision, m.Category, m.Question, m.Answer)
+	})
 }
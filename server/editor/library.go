@@ -0,0 +1,86 @@
+package editor
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"path"
+
+	"github.com/baconstrip/kiken/game"
+	"github.com/baconstrip/kiken/util"
+)
+
+// Library lists the shows saved in a directory and loads them for play.
+type Library struct {
+	dir string
+}
+
+// NewLibrary creates a Library of the shows saved in dir.
+func NewLibrary(dir string) *Library {
+	return &Library{dir: dir}
+}
+
+// showID returns the ID used to refer to the show saved in the named file.
+func showID(filename string) string {
+	hasher := sha512.New()
+	hasher.Write([]byte(filename))
+	return base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+}
+
+// showFiles returns the file names of the shows in the library, keyed by ID.
+// The directory is read on every call so that newly saved shows are found.
+func (l *Library) showFiles() (map[string]string, error) {
+	files, err := util.GetFilesInDir(l.dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not list shows: %v", err)
+	}
+
+	shows := make(map[string]string)
+	for _, f := range files {
+		if path.Ext(f) != ".json" {
+			continue
+		}
+		shows[showID(f)] = f
+	}
+	return shows, nil
+}
+
+// ListShows returns the names of the shows in the library, keyed by ID.
+func (l *Library) ListShows() (map[string]string, error) {
+	files, err := l.showFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	shows := make(map[string]string)
+	for id, f := range files {
+		shows[id] = f[:len(f)-len(path.Ext(f))]
+	}
+	return shows, nil
+}
+
+// LoadShow opens the show with the given ID and returns the game it describes.
+func (l *Library) LoadShow(id string) (*game.Game, error) {
+	files, err := l.showFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	f, ok := files[id]
+	if !ok {
+		return nil, fmt.Errorf("no show with ID %v", id)
+	}
+
+	p, err := util.SafeJoin(l.dir, f)
+	if err != nil {
+		return nil, err
+	}
+	show, err := OpenShow(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := show.Playable(); err != nil {
+		return nil, err
+	}
+	return show.Game(), nil
+}
@@ -0,0 +1,80 @@
+package editor
+
+import (
+	"sort"
+
+	"github.com/baconstrip/kiken/server"
+)
+
+// openShow returns the show with ID id, opening it from path unless an editor
+// already has it open. Editors with the same show open share one copy of it,
+// so that their changes don't overwrite each other.
+// Callers must obtain a mutex before calling.
+func (e *EditorDriver) openShow(id, path string) (*Show, error) {
+	if show, ok := e.openShows[id]; ok {
+		return show, nil
+	}
+	show, err := OpenShow(path)
+	if err != nil {
+		return nil, err
+	}
+	e.openShows[show.id] = show
+	return show, nil
+}
+
+// setCurrentShow makes show the one the editor name is editing, closing the
+// show they had open before if nobody else is editing it. show may be nil to
+// close their show.
+// Callers must obtain a mutex before calling.
+func (e *EditorDriver) setCurrentShow(name string, show *Show) {
+	session := e.session(name)
+	prev := session.currentShow
+	session.currentShow = show
+	if show != nil {
+		e.openShows[show.id] = show
+	}
+	if prev != nil && prev != show {
+		e.closeIfUnused(prev)
+		// The editors left on it see that this one has gone.
+		e.sendBoards(prev, "")
+	}
+}
+
+// closeIfUnused forgets show if no editor has it open.
+// Callers must obtain a mutex before calling.
+func (e *EditorDriver) closeIfUnused(show *Show) {
+	for _, session := range e.sessions {
+		if session.currentShow == show {
+			return
+		}
+	}
+	if e.openShows[show.id] == show {
+		delete(e.openShows, show.id)
+	}
+}
+
+// editorsOf returns the names of the editors with show open, in order.
+// Callers must obtain a mutex before calling.
+func (e *EditorDriver) editorsOf(show *Show) []string {
+	var names []string
+	for name, session := range e.sessions {
+		if session.currentShow == show {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sendBoards sends show's boards to every editor with it open. editedBy names
+// the editor whose change is being sent, if any.
+// Callers must obtain a mutex before calling.
+func (e *EditorDriver) sendBoards(show *Show, editedBy string) {
+	update := show.Boards()
+	update.Editors = e.editorsOf(show)
+	update.EditedBy = editedBy
+	msg := server.EncodeServerMessage(update)
+	for _, name := range update.Editors {
+		e.server.MessageEditor(msg, name)
+	}
+}
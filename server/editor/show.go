@@ -1,58 +1,113 @@
 package editor
 
 import (
-	"crypto/sha512"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/baconstrip/kiken/common"
 	"github.com/baconstrip/kiken/game"
 	"github.com/baconstrip/kiken/question"
+	"github.com/baconstrip/kiken/util"
 )
 
 // TODO: This needs to be reconcilled with the Game type
 type Show struct {
-	filepath string
+	// dir is the directory the show is saved in, and filename the name of
+	// its file there.
+	dir      string
+	filename string
 	name     string
 	id       string
 
+	// title, author and notes describe the show. The title defaults to the
+	// show's name.
+	title  string
+	author string
+	notes  string
+	// created and modified are when the show was created and last saved.
+	created  time.Time
+	modified time.Time
+
+	// revisions counts the changes made to each clue since the show was
+	// opened.
+	revisions map[*question.Question]int
+
 	Rounds []*game.Board
 }
 
+// Save writes the show back to the file it was opened from, as a
+// ShowDocument. Shows opened from the legacy format are converted.
 func (s *Show) Save() error {
-	questions := []*question.Question{}
-	for _, r := range s.Rounds {
-		for _, c := range r.Categories {
-			questions = append(questions, c.Questions...)
-		}
+	now := time.Now()
+	if s.created.IsZero() {
+		s.created = now
 	}
-	bytes, err := json.Marshal(questions)
+	s.modified = now
+
+	bytes, err := json.MarshalIndent(s.document(), "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to save game, error marshaling: %v", err)
 	}
 
-	filepath := DataDir + s.filepath
-
-	err = os.WriteFile(filepath, bytes, 0o755)
+	path, err := util.SafeJoin(s.dir, s.filename)
+	if err != nil {
+		return fmt.Errorf("failed to save game: %v", err)
+	}
+	err = util.WriteFileAtomic(path, bytes, 0o644)
 	if err != nil {
 		return fmt.Errorf("failed to save game, error saving: %v", err)
 	}
 	return nil
 }
 
+// OpenShow opens the show saved at inputPath, either as a ShowDocument or in
+// the legacy format.
 func OpenShow(inputPath string) (*Show, error) {
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open show file %v: %v", inputPath, err)
+	}
+
+	var show *Show
+	if isLegacyShow(data) {
+		show, err = openLegacyShow(inputPath)
+	} else {
+		show, err = decodeShowDocument(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open show file %v: %v", inputPath, err)
+	}
+
+	filename := path.Base(inputPath)
+	show.dir = filepath.Dir(inputPath)
+	show.filename = filename
+	show.name = filename[:len(filename)-len(path.Ext(filename))]
+	show.id = showID(filename)
+	if show.title == "" {
+		show.title = show.name
+	}
+	return show, nil
+}
+
+// openLegacyShow opens a show saved in the legacy format, a flat list of
+// questions that question.LoadQuestions reads. Boards are rebuilt from the
+// questions' categories, which are kept in the order they were saved in.
+func openLegacyShow(inputPath string) (*Show, error) {
 	questions, err := question.LoadQuestions(inputPath)
 	if err != nil {
-		return nil, fmt.Errorf("could not open question file %v: %v", inputPath, err)
+		return nil, err
 	}
 
 	categories, err := question.CollateFullCategories(questions, false)
 	if err != nil {
 		return nil, fmt.Errorf("could not correlate questions during Show load: %v", err)
 	}
+	sortByFirstQuestion(categories, questions)
 
 	var owari *question.Question
 	for _, q := range questions {
@@ -85,9 +140,14 @@ func OpenShow(inputPath string) (*Show, error) {
 		}
 	}
 
-	owariCategory, err := game.NewCategory(owari)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make owari category: %v", err)
+	// Shows still being written may not have an Owari clue yet.
+	var owariCategories []*question.Category
+	if owari != nil {
+		owariCategory, err := game.NewCategory(owari)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make owari category: %v", err)
+		}
+		owariCategories = append(owariCategories, owariCategory)
 	}
 
 	daiichiBoard := game.Board{
@@ -100,38 +160,78 @@ func OpenShow(inputPath string) (*Show, error) {
 	}
 
 	owariBoard := game.Board{
-		Categories: []*question.Category{owariCategory},
+		Categories: owariCategories,
 		Round:      common.OWARI,
 	}
 
-	filename := path.Base(inputPath)
-	ext := path.Ext(filename)
-	cleaned := filename[:len(filename)-len(ext)]
+	rounds := []*game.Board{
+		&daiichiBoard,
+		&dainiBoard,
+		&owariBoard,
+	}
+	if tiebreakers := question.CollateLoneQuestions(questions, common.TIEBREAKER); len(tiebreakers) > 0 {
+		rounds = append(rounds, game.NewBoard(common.TIEBREAKER, tiebreakers...))
+	}
+
+	// The legacy format has no timestamps, so the file's are the best guess.
+	show := &Show{Rounds: rounds}
+	if info, err := os.Stat(inputPath); err == nil {
+		show.created = info.ModTime()
+		show.modified = info.ModTime()
+	}
+	return show, nil
+}
+
+// sortByFirstQuestion sorts categories into the order their first questions
+// appear in questions, which is the order they were saved in.
+func sortByFirstQuestion(categories []*question.Category, questions []*question.Question) {
+	first := make(map[string]int)
+	for i, q := range questions {
+		if _, ok := first[q.Category]; !ok {
+			first[q.Category] = i
+		}
+	}
+	sort.SliceStable(categories, func(i, j int) bool {
+		return first[categories[i].Name] < first[categories[j].Name]
+	})
+}
 
-	hasher := sha512.New()
-	hasher.Write([]byte(filename))
-	sha := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+// Playable returns an error if the show can't be played yet.
+func (s *Show) Playable() error {
+	for _, b := range s.Rounds {
+		if b.Round == common.OWARI && len(b.Categories) > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("show %v has no owari question", s.name)
+}
+
+// Game returns the game played from the show's boards.
+func (s *Show) Game() *game.Game {
+	return game.New(s.Rounds...)
+}
 
-	return &Show{
-		filepath: inputPath,
-		name:     cleaned,
-		id:       sha,
+// NewShow creates an empty show named name, to be saved in DataDir.
+func NewShow(name string) *Show {
+	s := &Show{
 		Rounds: []*game.Board{
-			&daiichiBoard,
-			&dainiBoard,
-			&owariBoard,
+			game.NewBoard(common.DAIICHI),
+			game.NewBoard(common.DAINI),
+			game.NewBoard(common.OWARI),
 		},
-	}, nil
+	}
+	s.setName(name)
+	return s
 }
 
-func NewShow(filepath string) *Show {
-	hasher := sha512.New()
-	hasher.Write([]byte(filepath))
-	sha := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
-	return &Show{
-		filepath: filepath + ".json",
-		id:       sha,
-		// TODO allow making this a name
-		name: filepath,
+// setName names the show, which changes the file it's saved to and its ID. A
+// title that was just the old name follows the new one.
+func (s *Show) setName(name string) {
+	if s.title == "" || s.title == s.name {
+		s.title = name
 	}
+	s.dir = DataDir
+	s.filename = name + ".json"
+	s.id = showID(s.filename)
+	s.name = name
 }
@@ -0,0 +1,229 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/server"
+	"github.com/baconstrip/kiken/util"
+)
+
+// maxShowNameLength is the longest name a show can be given.
+const maxShowNameLength = 100
+
+// showPath returns the path of the show file named filename in DataDir,
+// refusing names that would reach outside of it.
+func showPath(filename string) (string, error) {
+	return util.SafeJoin(DataDir, filename)
+}
+
+// availableShows creates the AvailableShows message from the shows the editor
+// knows about.
+// Callers must obtain a mutex before calling.
+func (e *EditorDriver) availableShows() *message.AvailableShows {
+	shows := make(map[string]string)
+	for id, f := range e.knownShows {
+		shows[id] = f[:len(f)-len(path.Ext(f))]
+	}
+	return &message.AvailableShows{Shows: shows}
+}
+
+// sendAvailableShows rereads the shows on disk, and sends them to every
+// editor, so that they all see shows that were added, renamed or deleted.
+// Callers must obtain a mutex before calling.
+func (e *EditorDriver) sendAvailableShows() {
+	e.refreshGamesFromDisk()
+	e.server.MessageEditors(server.EncodeServerMessage(e.availableShows()))
+}
+
+// checkShowName returns an error if a show can't be named name, because it
+// can't be used as a file name or another show already has it.
+// Callers must obtain a mutex before calling.
+func (e *EditorDriver) checkShowName(name string) error {
+	if name == "" || strings.TrimSpace(name) != name {
+		return errors.New("show names can't be blank, or start or end with spaces")
+	}
+	if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return errors.New("show names can't contain slashes, or start with a dot")
+	}
+	if len(name) > maxShowNameLength {
+		return fmt.Errorf("show names can't be longer than %v characters", maxShowNameLength)
+	}
+	p, err := showPath(name + ".json")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(p); err == nil {
+		return fmt.Errorf("there's already a show named %q", name)
+	}
+	return nil
+}
+
+// findShow returns the file name of the show with ID id, and tells the editor
+// name if there isn't one.
+// Callers must obtain a mutex before calling.
+func (e *EditorDriver) findShow(name, id string) (string, bool) {
+	e.refreshGamesFromDisk()
+	f, ok := e.knownShows[id]
+	if !ok {
+		e.sendError(name, 1404, fmt.Errorf("no show with ID %v", id))
+	}
+	return f, ok
+}
+
+// openForEditing makes show the one the editor name is editing, and sends its
+// boards to everyone editing it, so they see who's joined them.
+// Callers must obtain a mutex before calling.
+func (e *EditorDriver) openForEditing(name string, show *Show) {
+	e.setCurrentShow(name, show)
+	e.sendBoards(show, "")
+}
+
+func (e *EditorDriver) onCreateShowCreate(name string, _ bool, msg message.ClientMessage) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	showName := msg.Data.(*message.CreateShow).Name
+	if err := e.checkShowName(showName); err != nil {
+		e.sendError(name, 1405, err)
+		return nil
+	}
+
+	show := NewShow(showName)
+	if err := show.Save(); err != nil {
+		log.Printf("Failed to create show %q: %v", showName, err)
+		e.sendError(name, 1407, err)
+		return nil
+	}
+	log.Printf("Editor %v created show %q", name, showName)
+
+	e.openForEditing(name, show)
+	e.sendAvailableShows()
+	return nil
+}
+
+func (e *EditorDriver) onRenameShowRename(name string, _ bool, msg message.ClientMessage) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	m := msg.Data.(*message.RenameShow)
+	f, ok := e.findShow(name, m.ShowID)
+	if !ok {
+		return nil
+	}
+	if err := e.checkShowName(m.Name); err != nil {
+		e.sendError(name, 1405, err)
+		return nil
+	}
+
+	from, err := showPath(f)
+	if err != nil {
+		e.sendError(name, 1404, err)
+		return nil
+	}
+	to, err := showPath(m.Name + ".json")
+	if err != nil {
+		e.sendError(name, 1405, err)
+		return nil
+	}
+	if err := os.Rename(from, to); err != nil {
+		log.Printf("Failed to rename show %q: %v", f, err)
+		e.sendError(name, 1407, fmt.Errorf("failed to rename show: %v", err))
+		return nil
+	}
+	log.Printf("Editor %v renamed show %q to %q", name, f, m.Name)
+
+	// Editors with the show open keep editing it under its new name.
+	if show, ok := e.openShows[m.ShowID]; ok {
+		delete(e.openShows, m.ShowID)
+		show.setName(m.Name)
+		e.openShows[show.id] = show
+		e.sendBoards(show, name)
+	}
+	e.sendAvailableShows()
+	return nil
+}
+
+func (e *EditorDriver) onDuplicateShowDuplicate(name string, _ bool, msg message.ClientMessage) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	m := msg.Data.(*message.DuplicateShow)
+	f, ok := e.findShow(name, m.ShowID)
+	if !ok {
+		return nil
+	}
+	if err := e.checkShowName(m.Name); err != nil {
+		e.sendError(name, 1405, err)
+		return nil
+	}
+
+	p, err := showPath(f)
+	if err != nil {
+		e.sendError(name, 1404, err)
+		return nil
+	}
+	show, err := OpenShow(p)
+	if err != nil {
+		e.sendError(name, 1400, fmt.Errorf("failed to open show to copy: %v", err))
+		return nil
+	}
+	show.setName(m.Name)
+	// The copy is a new show, so it's created when it's saved.
+	show.created = time.Time{}
+	if err := show.Save(); err != nil {
+		log.Printf("Failed to copy show %q: %v", f, err)
+		e.sendError(name, 1407, err)
+		return nil
+	}
+	log.Printf("Editor %v copied show %q to %q", name, f, m.Name)
+
+	e.openForEditing(name, show)
+	e.sendAvailableShows()
+	return nil
+}
+
+func (e *EditorDriver) onDeleteShowDelete(name string, _ bool, msg message.ClientMessage) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	m := msg.Data.(*message.DeleteShow)
+	f, ok := e.findShow(name, m.ShowID)
+	if !ok {
+		return nil
+	}
+	if showName := f[:len(f)-len(path.Ext(f))]; m.Confirm != showName {
+		e.sendError(name, 1406, fmt.Errorf("type the show's name, %q, to confirm deleting it", showName))
+		return nil
+	}
+
+	p, err := showPath(f)
+	if err != nil {
+		e.sendError(name, 1404, err)
+		return nil
+	}
+	if err := os.Remove(p); err != nil {
+		log.Printf("Failed to delete show %q: %v", f, err)
+		e.sendError(name, 1407, fmt.Errorf("failed to delete show: %v", err))
+		return nil
+	}
+	log.Printf("Editor %v deleted show %q", name, f)
+
+	if show, ok := e.openShows[m.ShowID]; ok {
+		delete(e.openShows, m.ShowID)
+		for editor, session := range e.sessions {
+			if session.currentShow == show {
+				session.currentShow = nil
+				e.sendError(editor, 1408, errors.New("the show you had open was deleted"))
+			}
+		}
+	}
+	e.sendAvailableShows()
+	return nil
+}
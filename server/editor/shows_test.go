@@ -0,0 +1,74 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckShowName(t *testing.T) {
+	DataDir = t.TempDir()
+	if err := NewShow("taken").Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	e := &EditorDriver{}
+	for _, tc := range []struct {
+		name string
+		ok   bool
+	}{
+		{"new show", true},
+		{"taken", false},
+		{"", false},
+		{" padded", false},
+		{"../escape", false},
+		{`back\slash`, false},
+		{".hidden", false},
+	} {
+		if err := e.checkShowName(tc.name); (err == nil) != tc.ok {
+			t.Errorf("checkShowName(%q) = %v, want ok %v", tc.name, err, tc.ok)
+		}
+	}
+}
+
+func TestNewShowReopens(t *testing.T) {
+	DataDir = t.TempDir()
+	if err := NewShow("empty").Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	show, err := OpenShow(filepath.Join(DataDir, "empty.json"))
+	if err != nil {
+		t.Fatalf("OpenShow() of a new show failed: %v", err)
+	}
+	if err := show.Playable(); err == nil {
+		t.Errorf("Playable() of a show with no owari clue succeeded")
+	}
+
+	if err := show.SetOwari("", 0, "final", "question", "answer"); err != nil {
+		t.Fatalf("SetOwari() failed: %v", err)
+	}
+	if err := show.Playable(); err != nil {
+		t.Errorf("Playable() after setting the owari clue = %v", err)
+	}
+}
+
+func TestSaveStaysInDataDir(t *testing.T) {
+	DataDir = t.TempDir()
+	s := NewShow("inside")
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(DataDir, "inside.json"))
+	if err != nil {
+		t.Fatalf("saved show not found: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o644 {
+		t.Errorf("saved show has permissions %v, want %v", perm, os.FileMode(0o644))
+	}
+
+	s.setName("../outside")
+	if err := s.Save(); err == nil {
+		t.Errorf("Save() of a show named to escape the data directory succeeded")
+	}
+}
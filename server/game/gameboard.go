@@ -2,6 +2,7 @@ package game
 
 import (
 	"fmt"
+	"math/rand"
 	"sort"
 
 	"github.com/baconstrip/kiken/common"
@@ -36,6 +37,61 @@ func NewBoard(round common.Round, categories ...*question.Category) *Board {
 	}
 }
 
+// clone returns a copy of the board and its categories without any pachi
+// questions picked, so that picking them for one game can't change another
+// game made from the same board. Questions are shared, since they're never
+// changed.
+func (b *Board) clone() *Board {
+	categories := make([]*question.Category, 0, len(b.Categories))
+	for _, c := range b.Categories {
+		copied := *c
+		copied.Questions = append([]*question.Question{}, c.Questions...)
+		categories = append(categories, &copied)
+	}
+	return NewBoard(b.Round, categories...)
+}
+
+// PickPachi designates count questions on the board as pachi questions,
+// choosing at random with r and never taking two from the same category. Any
+// previous designation is replaced.
+func (b *Board) PickPachi(r *rand.Rand, count int) {
+	b.pachi = nil
+	for _, i := range r.Perm(len(b.Categories)) {
+		if len(b.pachi) == count {
+			break
+		}
+		c := b.Categories[i]
+		if len(c.Questions) == 0 {
+			continue
+		}
+		b.pachi = append(b.pachi, c.Questions[r.Intn(len(c.Questions))])
+	}
+}
+
+// IsPachi returns whether the question with the given ID is a pachi question on
+// this board.
+func (b *Board) IsPachi(id string) bool {
+	for _, q := range b.pachi {
+		if q.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// TopValue returns the value of the most valuable question on the board.
+func (b *Board) TopValue() int {
+	top := 0
+	for _, c := range b.Categories {
+		for _, q := range c.Questions {
+			if q.Value > top {
+				top = q.Value
+			}
+		}
+	}
+	return top
+}
+
 func NewCategory(questions ...*question.Question) (*question.Category, error) {
 	var name string
 	for _, q := range questions {
@@ -0,0 +1,62 @@
+package game
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/baconstrip/kiken/common"
+	"github.com/baconstrip/kiken/question"
+)
+
+func testCategory(name string, round common.Round, values ...int) *question.Category {
+	c := &question.Category{Name: name, Round: round}
+	for _, v := range values {
+		c.Questions = append(c.Questions, &question.Question{
+			Category: name,
+			Value:    v,
+			Round:    round,
+			ID:       name + strconv.Itoa(v),
+		})
+	}
+	return c
+}
+
+func TestPickPachi(t *testing.T) {
+	var cats []*question.Category
+	for i := 0; i < 6; i++ {
+		cats = append(cats, testCategory("cat"+strconv.Itoa(i), common.DAINI, 400, 800, 1200, 1600, 2000))
+	}
+	b := NewBoard(common.DAINI, cats...)
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		b.PickPachi(r, 2)
+		if len(b.pachi) != 2 {
+			t.Fatalf("PickPachi(2) picked %v questions", len(b.pachi))
+		}
+		if b.pachi[0].Category == b.pachi[1].Category {
+			t.Errorf("PickPachi picked two questions from category %v", b.pachi[0].Category)
+		}
+		for _, q := range b.pachi {
+			if !b.IsPachi(q.ID) {
+				t.Errorf("IsPachi(%v) = false for a picked question", q.ID)
+			}
+		}
+	}
+
+	if b.IsPachi("missing") {
+		t.Errorf("IsPachi returned true for an unknown question")
+	}
+	if got := b.TopValue(); got != 2000 {
+		t.Errorf("TopValue() = %v, want 2000", got)
+	}
+}
+
+func TestPickPachiMoreThanCategories(t *testing.T) {
+	b := NewBoard(common.DAIICHI, testCategory("only", common.DAIICHI, 200, 400))
+	b.PickPachi(rand.New(rand.NewSource(1)), 3)
+	if len(b.pachi) != 1 {
+		t.Errorf("PickPachi(3) on a single category board picked %v questions, want 1", len(b.pachi))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"math"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/baconstrip/kiken/common"
@@ -26,9 +27,49 @@ type Configuration struct {
 	// How long players are given to answer a question.
 	AnswerTime time.Duration
 
+	// What happens when a player runs out of time to answer.
+	AnswerTimeoutAction AnswerTimeoutAction
+
 	// StartingPhase is the phase the game should start at.
 	// one of: "daiichi", "daini", "owari"
 	StartingPhase string
+
+	// SavePath is where the game is saved after every change, so that it can
+	// be restored if the server restarts. Games aren't saved if it's empty.
+	SavePath string
+}
+
+// DefaultConfiguration returns the Configuration used for normal play.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		ChanceTime:          7 * time.Second,
+		DisambiguationTime:  200 * time.Millisecond,
+		AnswerTime:          10 * time.Second,
+		AnswerTimeoutAction: ANSWER_TIMEOUT_MARK_INCORRECT,
+		StartingPhase:       "daiichi",
+	}
+}
+
+type AnswerTimeoutAction int
+
+const (
+	// The answer is marked incorrect, as though the host had marked it.
+	ANSWER_TIMEOUT_MARK_INCORRECT AnswerTimeoutAction = iota
+	// The host is alerted, and is left to mark the answer.
+	ANSWER_TIMEOUT_ALERT_HOST
+)
+
+// ParseAnswerTimeoutAction converts the name of an AnswerTimeoutAction, either
+// "mark-incorrect" or "alert-host", to its value.
+func ParseAnswerTimeoutAction(s string) (AnswerTimeoutAction, error) {
+	switch s {
+	case "mark-incorrect":
+		return ANSWER_TIMEOUT_MARK_INCORRECT, nil
+	case "alert-host":
+		return ANSWER_TIMEOUT_ALERT_HOST, nil
+	default:
+		return 0, fmt.Errorf("unknown answer timeout action: %v", s)
+	}
 }
 
 // GameDriver is the main object that manages a game.
@@ -36,15 +77,20 @@ type GameDriver struct {
 	// TODO refactor a mutex into this struct, instead of relying on the mutex
 	// of the GameState.
 	gameState       *GameState
-	server          *server.Server
+	room            *server.Room
 	listenerManager *server.ListenerManager
 
 	config Configuration
 
 	quesState  *questionPromptState
 	owariState *owariState
+	tiebreaker *tiebreakerState
+	gameOver   *message.GameOver
 
 	metagame *MetaGameDriver
+	history  *PlayHistory
+
+	saver *saver
 }
 
 type questionPromptState struct {
@@ -55,12 +101,45 @@ type questionPromptState struct {
 	buzzCloseTimerSet bool
 	playerAnswering   string
 
-	buzzTimeoutUnless unlessFunc
+	// pachi is set when the question is a pachi question, in which case only
+	// playerAnswering may answer, for the amount in pachiBid.
+	pachi    bool
+	pachiBid int
+
+	buzzTimer   *gameTimer
+	selectTimer *gameTimer
+	answerTimer *gameTimer
+}
+
+func (q *questionPromptState) timers() []*gameTimer {
+	return []*gameTimer{q.buzzTimer, q.selectTimer, q.answerTimer}
 }
 
 type owariState struct {
 	bids    map[string]int
 	answers map[string]string
+	// marked records whether the host judged each player's answer correct,
+	// once it has been marked.
+	marked map[string]bool
+}
+
+// copy returns a copy of the state that doesn't share its maps.
+func (o *owariState) copy() *owariState {
+	c := &owariState{
+		bids:    make(map[string]int, len(o.bids)),
+		answers: make(map[string]string, len(o.answers)),
+		marked:  make(map[string]bool, len(o.marked)),
+	}
+	for name, bid := range o.bids {
+		c.bids[name] = bid
+	}
+	for name, answer := range o.answers {
+		c.answers[name] = answer
+	}
+	for name, correct := range o.marked {
+		c.marked[name] = correct
+	}
+	return c
 }
 
 type PlayerStats struct {
@@ -84,13 +163,13 @@ func (g *GameDriver) sendUpdateBoard() {
 		return
 	}
 	overview := server.EncodeServerMessage(b.Snapshot().ToBoardOverview())
-	g.server.MessageAll(overview)
+	g.room.MessageAll(overview)
 }
 
 func (g *GameDriver) sendOwariHost() {
 	cat := g.gameState.Boards[common.OWARI-1].Categories[0]
 	owari := message.BeginOwari{Category: cat.Snapshot().ToCategoryOverview()}
-	g.server.MessageHost(server.EncodeServerMessage(&owari))
+	g.room.MessageHost(server.EncodeServerMessage(&owari))
 }
 
 func (g *GameDriver) sendOwariPlayer(name string) {
@@ -98,7 +177,7 @@ func (g *GameDriver) sendOwariPlayer(name string) {
 	owari := message.BeginOwari{Category: cat.Snapshot().ToCategoryOverview()}
 	plyOwari := owari
 	plyOwari.Money = g.metagame.players[name].Money
-	g.server.MessagePlayer(server.EncodeServerMessage(&plyOwari), name)
+	g.room.MessagePlayer(server.EncodeServerMessage(&plyOwari), name)
 }
 
 func (g *GameDriver) sendOwari() {
@@ -108,42 +187,83 @@ func (g *GameDriver) sendOwari() {
 	}
 
 	overview := server.EncodeServerMessage(g.gameState.Boards[common.OWARI-1].Snapshot().ToBoardOverview())
-	g.server.MessageAll(overview)
+	g.room.MessageAll(overview)
 }
 
 func (g *GameDriver) showOwariPromptHost() {
 	ques := g.gameState.Boards[common.OWARI-1].Categories[0].Questions[0]
 	snap := ques.Snapshot()
 	hostPrompt := snap.ToQuestionPrompt(true)
-	g.server.MessageHost(server.EncodeServerMessage(&message.ShowOwariPrompt{Prompt: hostPrompt}))
+	g.room.MessageHost(server.EncodeServerMessage(&message.ShowOwariPrompt{Prompt: hostPrompt}))
 }
 
 func (g *GameDriver) showOwariPromptPlayer(name string) {
 	ques := g.gameState.Boards[common.OWARI-1].Categories[0].Questions[0]
 	snap := ques.Snapshot()
 	playerPrompt := snap.ToQuestionPrompt(false)
-	g.server.MessagePlayer(server.EncodeServerMessage(&message.ShowOwariPrompt{Prompt: playerPrompt}), name)
+	g.room.MessagePlayer(server.EncodeServerMessage(&message.ShowOwariPrompt{Prompt: playerPrompt}), name)
 }
 
 // showOwariPrompt should only be called after obtaining the mutex.
 func (g *GameDriver) showOwariPrompt() {
 	g.gameState.currentStatus = STATUS_OWARI_AWAIT_ANSWERS
+	// The Owari question stays on the board, so it's only recorded in the
+	// history.
+	g.history.MarkPlayed(g.gameState.Boards[common.OWARI-1].Categories[0].Questions[0].Data.ID)
 	g.showOwariPromptHost()
 	for name := range g.metagame.players {
 		g.showOwariPromptPlayer(name)
 	}
 }
 
-func (g *GameDriver) showOwariAnswer(name string) {
-	msg := message.ShowOwariResults{Answers: g.owariState.answers, Bids: g.owariState.bids}
-	g.server.MessagePlayer(server.EncodeServerMessage(&msg), name)
+// owariResults creates the ShowOwariResults message. Players only see the
+// answers the host has already marked, while the host sees every answer.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) owariResults(host bool) *message.ShowOwariResults {
+	if host {
+		return &message.ShowOwariResults{Answers: g.owariState.answers, Bids: g.owariState.bids, Correct: g.owariState.marked}
+	}
+
+	msg := &message.ShowOwariResults{
+		Answers: make(map[string]string),
+		Bids:    make(map[string]int),
+		Correct: make(map[string]bool),
+	}
+	for name, correct := range g.owariState.marked {
+		msg.Answers[name] = g.owariState.answers[name]
+		msg.Bids[name] = g.owariState.bids[name]
+		msg.Correct[name] = correct
+	}
+	return msg
+}
+
+func (g *GameDriver) showOwariAnswer(name string, host bool) {
+	g.room.MessagePlayer(server.EncodeServerMessage(g.owariResults(host)), name)
 }
 
 // showOwariAnswers should only be called after obtaining the mutex.
 func (g *GameDriver) showOwariAnswers() {
 	g.gameState.currentStatus = STATUS_SHOWING_OWARI
-	msg := message.ShowOwariResults{Answers: g.owariState.answers, Bids: g.owariState.bids}
-	g.server.MessageAll(server.EncodeServerMessage(&msg))
+	g.room.MessageHost(server.EncodeServerMessage(g.owariResults(true)))
+	g.room.MessagePlayers(server.EncodeServerMessage(g.owariResults(false)))
+}
+
+// owariResolved returns whether the host has marked every Owari answer.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) owariResolved() bool {
+	for name := range g.owariState.bids {
+		if _, ok := g.owariState.marked[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// markPlayed marks a question as played on the board and in the play history.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) markPlayed(q *question.QuestionState) {
+	q.Played = true
+	g.history.MarkPlayed(q.Data.ID)
 }
 
 // playerSelecting returns the Stats struct of the player that is currently
@@ -158,6 +278,76 @@ func (g *GameDriver) playerSelecting() *PlayerStats {
 	return nil
 }
 
+// openResponses begins accepting buzzes for the current question from any
+// player that hasn't already tried to answer it.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) openResponses() {
+	resp := message.OpenResponses{
+		Interval: int(g.config.ChanceTime.Seconds() * 1000),
+	}
+	g.room.MessageAll(server.EncodeServerMessage(&resp))
+	g.gameState.currentStatus = STATUS_PLAYERS_BUZZING
+	log.Printf("all players counting down")
+	g.quesState.questionOpened = time.Now()
+	g.quesState.attemptedBuzzes = make(map[string]int)
+	g.quesState.buzzCloseTimerSet = false
+
+	g.quesState.buzzTimer.Stop()
+	g.quesState.buzzTimer = startTimer(&g.gameState.mu, g.config.ChanceTime, g.persistedTimed(g.TimedTimeOutBuzzing))
+}
+
+// maxPachiBid returns the most a player may wager on a pachi question, which is
+// the greater of their score and the most valuable question in the round.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) maxPachiBid(name string) int {
+	max := g.gameState.CurrentBoard().data.TopValue()
+	if ply, ok := g.metagame.players[name]; ok && ply.Money > max {
+		max = ply.Money
+	}
+	return max
+}
+
+func (g *GameDriver) beginPachiMessage() *message.BeginPachi {
+	return &message.BeginPachi{
+		Name:     g.quesState.playerAnswering,
+		Category: g.quesState.question.Data.Category,
+		MaxBid:   g.maxPachiBid(g.quesState.playerAnswering),
+	}
+}
+
+// beginPachi starts the wager for a pachi question, which may only be played by
+// the player that selected it.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) beginPachi(q *question.QuestionState, selector *PlayerStats) {
+	g.gameState.currentStatus = STATUS_ACCEPTING_PACHI_BID
+	g.quesState = &questionPromptState{
+		attemptedBuzzes: make(map[string]int),
+		question:        q,
+		playerAnswering: selector.Name,
+		pachi:           true,
+	}
+	g.markPlayed(q)
+	g.room.MessageAll(server.EncodeServerMessage(g.beginPachiMessage()))
+}
+
+// settlePachi awards or deducts the wager on a pachi question and closes the
+// question, since nobody else may attempt it.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) settlePachi(correct bool) {
+	if s, ok := g.metagame.players[g.quesState.playerAnswering]; ok {
+		if correct {
+			s.Money += g.quesState.pachiBid
+		} else {
+			s.Money -= g.quesState.pachiBid
+		}
+	}
+
+	g.sendUpdateBoard()
+	g.gameState.currentStatus = STATUS_POST_QUESTION
+	g.room.MessageAll(server.EncodeServerMessage(&message.CloseResponses{}))
+	g.metagame.sendUpdatePlayers()
+}
+
 // ------ BEGIN LISTENERS -----
 
 func (g *GameDriver) OnJoinSendBoard(name string, host bool, spectator bool) error {
@@ -168,27 +358,44 @@ func (g *GameDriver) OnJoinSendBoard(name string, host bool, spectator bool) err
 		return nil
 	}
 
+	if g.gameState.currentStatus == STATUS_PAUSED {
+		g.room.MessagePlayer(server.EncodeServerMessage(&message.GamePaused{Interval: g.pausedInterval()}), name)
+	}
+	status := g.gameState.effectiveStatus()
+
+	if g.inTiebreaker() {
+		g.room.MessagePlayer(server.EncodeServerMessage(g.tiebreaker.beginMessage()), name)
+		if status == STATUS_GAME_OVER {
+			g.room.MessagePlayer(server.EncodeServerMessage(&message.TiebreakerWinner{Name: g.tiebreaker.winner}), name)
+			g.room.MessagePlayer(server.EncodeServerMessage(g.gameOver), name)
+		}
+		return nil
+	}
+
 	b := g.gameState.CurrentBoard()
 	if b == nil {
 		return nil
 	}
 
-	if !g.gameState.IsOwariState() {
+	if g.gameState.currentRound != common.OWARI {
 		msg := server.EncodeServerMessage(b.Snapshot().ToBoardOverview())
-		g.server.MessagePlayer(msg, name)
+		g.room.MessagePlayer(msg, name)
 	} else {
-		switch g.gameState.currentStatus {
+		switch status {
 		case STATUS_ACCEPTING_BIDS:
 			g.sendOwariPlayer(name)
 		case STATUS_OWARI_AWAIT_ANSWERS:
 			g.sendOwariPlayer(name)
 			g.showOwariPromptPlayer(name)
-		case STATUS_SHOWING_OWARI:
+		case STATUS_SHOWING_OWARI, STATUS_GAME_OVER:
 			g.sendOwariPlayer(name)
 			g.showOwariPromptPlayer(name)
-			g.showOwariAnswer(name)
+			g.showOwariAnswer(name, host)
+			if g.gameOver != nil {
+				g.room.MessagePlayer(server.EncodeServerMessage(g.gameOver), name)
+			}
 		default:
-			log.Fatalf("Unhandled Owari state on join: %v", g.gameState.currentStatus)
+			log.Fatalf("Unhandled Owari state on join: %v", status)
 		}
 	}
 
@@ -199,10 +406,19 @@ func (g *GameDriver) OnJoinShowQuestionPrompt(name string, host bool, spectator
 	g.gameState.mu.RLock()
 	defer g.gameState.mu.RUnlock()
 
-	if g.gameState.currentStatus == STATUS_PLAYERS_ANSWERING || g.gameState.currentStatus == STATUS_PRESENTING_QUESTION || g.gameState.currentStatus == STATUS_PLAYERS_BUZZING {
+	if g.inTiebreaker() && !host && !g.tiebreaker.includes(name) {
+		return nil
+	}
+
+	status := g.gameState.effectiveStatus()
+	if status == STATUS_PLAYERS_ANSWERING || status == STATUS_PRESENTING_QUESTION || status == STATUS_PLAYERS_BUZZING {
 		snap := g.quesState.question.Snapshot()
 		prompt := snap.ToQuestionPrompt(host)
-		g.server.MessagePlayer(server.EncodeServerMessage(prompt), name)
+		g.room.MessagePlayer(server.EncodeServerMessage(prompt), name)
+	}
+
+	if status == STATUS_ACCEPTING_PACHI_BID {
+		g.room.MessagePlayer(server.EncodeServerMessage(g.beginPachiMessage()), name)
 	}
 
 	return nil
@@ -232,24 +448,7 @@ func (g *GameDriver) OnLeaveStopAnswering(name string, host bool, spectator bool
 	g.gameState.mu.Lock()
 	defer g.gameState.mu.Unlock()
 
-	// On the chance they disconnect while answering, reset the state of
-	// answering a question.
-	if g.gameState.currentStatus == STATUS_PLAYERS_ANSWERING && g.quesState.playerAnswering == name {
-		resp := message.OpenResponses{
-			Interval: int(g.config.ChanceTime.Seconds() * 1000),
-		}
-		g.server.MessageAll(server.EncodeServerMessage(&resp))
-		g.gameState.currentStatus = STATUS_PLAYERS_BUZZING
-		log.Printf("all players counting down")
-		g.quesState.questionOpened = time.Now()
-		g.quesState.attemptedBuzzes = make(map[string]int)
-
-		unless := runAfterUnless(g.config.ChanceTime, g.TimedTimeOutBuzzing)
-		g.quesState.buzzTimeoutUnless = unless
-		if s, ok := g.metagame.players[g.quesState.playerAnswering]; ok {
-			g.metagame.players[g.quesState.playerAnswering].Money = s.Money - g.quesState.question.Data.Value
-		}
-	}
+	g.stopAnswering(name)
 
 	foundSelector := false
 
@@ -272,6 +471,30 @@ func (g *GameDriver) OnLeaveStopAnswering(name string, host bool, spectator bool
 	return nil
 }
 
+// stopAnswering ends the attempt of the player named name to answer, if they're
+// answering, and reopens the question to everyone else. A pachi question can
+// only be answered by the player that selected it, so it's closed instead.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) stopAnswering(name string) {
+	pachiInProgress := g.gameState.currentStatus == STATUS_ACCEPTING_PACHI_BID || g.gameState.currentStatus == STATUS_PLAYERS_ANSWERING
+
+	// A pachi question can't be passed to anyone else, so if the player leaves
+	// it's simply closed.
+	if pachiInProgress && g.quesState.pachi && g.quesState.playerAnswering == name {
+		g.quesState.answerTimer.Stop()
+		g.gameState.currentStatus = STATUS_POST_QUESTION
+		g.room.MessageAll(server.EncodeServerMessage(&message.CloseResponses{}))
+	} else if g.gameState.currentStatus == STATUS_PLAYERS_ANSWERING && g.quesState.playerAnswering == name {
+		// On the chance they disconnect while answering, reset the state of
+		// answering a question.
+		g.quesState.answerTimer.Stop()
+		g.openResponses()
+		if s, ok := g.metagame.players[g.quesState.playerAnswering]; ok && !g.inTiebreaker() {
+			g.metagame.players[g.quesState.playerAnswering].Money = s.Money - g.quesState.question.Data.Value
+		}
+	}
+}
+
 func (g *GameDriver) OnSelectQuestionMessageShowQuestion(name string, host bool, msg message.ClientMessage) error {
 	g.gameState.mu.Lock()
 	defer g.gameState.mu.Unlock()
@@ -290,22 +513,31 @@ func (g *GameDriver) OnSelectQuestionMessageShowQuestion(name string, host bool,
 	q := g.gameState.FindQuestion(sel.ID)
 	if q == nil {
 		e := server.EncodeServerMessage(&message.ServerError{Error: "Bad question", Code: 2000})
-		g.server.MessagePlayer(e, name)
+		g.room.MessagePlayer(e, name)
 		log.Printf("Bad question from client: %v", sel.ID)
 		return nil
 	}
+
+	if g.gameState.CurrentBoard().data.IsPachi(q.Data.ID) {
+		if selector := g.playerSelecting(); selector != nil {
+			g.beginPachi(q, selector)
+			return nil
+		}
+		log.Printf("Pachi question selected with nobody selecting, playing as a normal question")
+	}
+
 	snap := q.Snapshot()
 	playerPrompt := snap.ToQuestionPrompt(false)
 	hostPrompt := snap.ToQuestionPrompt(true)
-	g.server.MessagePlayers(server.EncodeServerMessage(playerPrompt))
-	g.server.MessageHost(server.EncodeServerMessage(hostPrompt))
+	g.room.MessagePlayers(server.EncodeServerMessage(playerPrompt))
+	g.room.MessageHost(server.EncodeServerMessage(hostPrompt))
 
 	g.gameState.currentStatus = STATUS_PRESENTING_QUESTION
 	g.quesState = &questionPromptState{
 		attemptedBuzzes: make(map[string]int),
 		question:        q,
 	}
-	q.Played = true
+	g.markPlayed(q)
 	return nil
 }
 
@@ -320,15 +552,7 @@ func (g *GameDriver) OnFinishReadingMessageBeginCountdown(name string, host bool
 		return nil
 	}
 
-	resp := message.OpenResponses{
-		Interval: int(g.config.ChanceTime.Seconds() * 1000),
-	}
-	g.server.MessageAll(server.EncodeServerMessage(&resp))
-	g.gameState.currentStatus = STATUS_PLAYERS_BUZZING
-	g.quesState.questionOpened = time.Now()
-
-	unless := runAfterUnless(g.config.ChanceTime, g.TimedTimeOutBuzzing)
-	g.quesState.buzzTimeoutUnless = unless
+	g.openResponses()
 	return nil
 }
 
@@ -343,6 +567,11 @@ func (g *GameDriver) OnAttemptAnswerMessageAllowAnswer(name string, host bool, m
 		return nil
 	}
 
+	// Only players tied for first may answer tiebreaker questions.
+	if g.inTiebreaker() && !g.tiebreaker.includes(name) {
+		return nil
+	}
+
 	// Players who have already tried to answer may not try again.
 	for _, n := range g.quesState.alreadyAnswered {
 		if n == name {
@@ -361,31 +590,78 @@ func (g *GameDriver) OnAttemptAnswerMessageAllowAnswer(name string, host bool, m
 		return nil
 	}
 
-	g.quesState.buzzTimeoutUnless()
-	runAfter(g.config.DisambiguationTime, g.TimedSelectPlayerToAnswer)
+	g.quesState.buzzTimer.Stop()
+	g.quesState.buzzCloseTimerSet = true
+	g.quesState.selectTimer.Stop()
+	g.quesState.selectTimer = startTimer(&g.gameState.mu, g.config.DisambiguationTime, g.persistedTimed(g.TimedSelectPlayerToAnswer))
 
 	return nil
 }
 
 func (g *GameDriver) OnMarkAnswerMessageMoveAlong(name string, host bool, msg message.ClientMessage) error {
+	if !host {
+		return nil
+	}
+
+	mark := msg.Data.(*message.MarkAnswer)
+	// With co-hosts, another host may have marked this attempt already, and
+	// play may have moved on to the next, so marks say which attempt they're
+	// for. Marks from clients that don't say are only taken from the host in
+	// control, so that co-hosts can't mark an attempt they haven't seen.
+	if mark.Attempt == 0 {
+		g.metagame.mu.RLock()
+		inControl := g.metagame.inControl(name)
+		g.metagame.mu.RUnlock()
+		if !inControl {
+			return nil
+		}
+	}
+
 	g.gameState.mu.Lock()
 	defer g.gameState.mu.Unlock()
 
-	if !host {
+	answering := g.gameState.currentStatus == STATUS_PLAYERS_ANSWERING
+	if mark.Attempt != 0 && (!answering || mark.Attempt != g.gameState.answerAttempt) {
+		e := server.EncodeServerMessage(&message.ServerError{Error: "Answer has already been marked", Code: 2005})
+		g.room.MessagePlayer(e, name)
 		return nil
 	}
-
-	if g.gameState.currentStatus != STATUS_PLAYERS_ANSWERING {
+	if !answering {
 		return nil
 	}
 
-	correct := msg.Data.(*message.MarkAnswer).Correct
+	marked := &message.AnswerMarked{
+		Name:     g.quesState.playerAnswering,
+		Correct:  mark.Correct,
+		Attempt:  g.gameState.answerAttempt,
+		MarkedBy: name,
+	}
+	g.markAnswer(mark.Correct)
+	g.room.MessageHost(server.EncodeServerMessage(marked))
+	return nil
+}
+
+// markAnswer judges the answer of the player currently answering, awarding or
+// deducting money and moving play along.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) markAnswer(correct bool) {
+	g.quesState.answerTimer.Stop()
+
+	if g.quesState.pachi {
+		g.settlePachi(correct)
+		return
+	}
+
+	if g.inTiebreaker() {
+		g.markTiebreakerAnswer(correct)
+		return
+	}
 
 	if correct {
 		g.sendUpdateBoard()
 		g.gameState.currentStatus = STATUS_POST_QUESTION
 
-		g.server.MessageAll(server.EncodeServerMessage(&message.CloseResponses{}))
+		g.room.MessageAll(server.EncodeServerMessage(&message.CloseResponses{}))
 		log.Printf("map: %p", &g.metagame.players)
 		if s, ok := g.metagame.players[g.quesState.playerAnswering]; ok {
 			log.Printf("found, granting %v", s)
@@ -393,30 +669,34 @@ func (g *GameDriver) OnMarkAnswerMessageMoveAlong(name string, host bool, msg me
 		}
 		// When a player gets a question correct, they get to pick next.
 		// fix this shit
-		g.playerSelecting().Selecting = false
-		g.metagame.players[g.quesState.playerAnswering].Selecting = true
+		if s, ok := g.metagame.players[g.quesState.playerAnswering]; ok {
+			if selector := g.playerSelecting(); selector != nil {
+				selector.Selecting = false
+			}
+			s.Selecting = true
+		}
 
 		g.metagame.sendUpdatePlayers()
-		return nil
-	}
-
-	resp := message.OpenResponses{
-		Interval: int(g.config.ChanceTime.Seconds() * 1000),
+		return
 	}
-	g.server.MessageAll(server.EncodeServerMessage(&resp))
-	g.gameState.currentStatus = STATUS_PLAYERS_BUZZING
-	log.Printf("all players counting down")
-	g.quesState.questionOpened = time.Now()
-	g.quesState.attemptedBuzzes = make(map[string]int)
 
-	unless := runAfterUnless(g.config.ChanceTime, g.TimedTimeOutBuzzing)
-	g.quesState.buzzTimeoutUnless = unless
+	g.openResponses()
 	if s, ok := g.metagame.players[g.quesState.playerAnswering]; ok {
 		g.metagame.players[g.quesState.playerAnswering].Money = s.Money - g.quesState.question.Data.Value
 	}
 	g.quesState.alreadyAnswered = append(g.quesState.alreadyAnswered, g.quesState.playerAnswering)
 	g.metagame.sendUpdatePlayers()
-	return nil
+}
+
+// startAnswerTimer begins the countdown for the player currently answering.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) startAnswerTimer() {
+	q := g.quesState
+	name := q.playerAnswering
+	q.answerTimer.Stop()
+	q.answerTimer = startTimer(&g.gameState.mu, g.config.AnswerTime, g.persistedTimed(func() error {
+		return g.TimedAnswerExpired(q, name)
+	}))
 }
 
 func (g *GameDriver) OnMoveOnMessageShowBoard(name string, host bool, msg message.ClientMessage) error {
@@ -432,7 +712,7 @@ func (g *GameDriver) OnMoveOnMessageShowBoard(name string, host bool, msg messag
 	}
 	g.sendUpdateBoard()
 
-	g.server.MessageAll(server.EncodeServerMessage(&message.HideQuestion{}))
+	g.room.MessageAll(server.EncodeServerMessage(&message.HideQuestion{}))
 	g.gameState.currentStatus = STATUS_SHOWING_BOARD
 	return nil
 }
@@ -476,14 +756,16 @@ func (g *GameDriver) OnEnterBidAddBid(name string, host bool, msg message.Client
 
 	bid := msg.Data.(*message.EnterBid).Money
 
-	g.owariState.bids[name] = bid
-
-	// If the bid is less than the amount they have or negative ignore it.
+	// If the bid is more than the amount they have or negative ignore it.
 	currentMoney := g.metagame.players[name].Money
 	if bid > currentMoney || currentMoney < 0 || bid < 0 {
+		e := server.EncodeServerMessage(&message.ServerError{Error: fmt.Sprintf("Bid must be between 0 and %v", currentMoney), Code: 2003})
+		g.room.MessagePlayer(e, name)
 		return nil
 	}
 
+	g.owariState.bids[name] = bid
+
 	// Check to see if all bids are in.
 	found := true
 	for n, ply := range g.metagame.players {
@@ -506,6 +788,46 @@ func (g *GameDriver) OnEnterBidAddBid(name string, host bool, msg message.Client
 	return nil
 }
 
+func (g *GameDriver) OnEnterBidPachiBid(name string, host bool, msg message.ClientMessage) error {
+	g.gameState.mu.Lock()
+	defer g.gameState.mu.Unlock()
+
+	if host {
+		return nil
+	}
+
+	if g.gameState.currentStatus != STATUS_ACCEPTING_PACHI_BID || g.quesState.playerAnswering != name {
+		return nil
+	}
+
+	bid := msg.Data.(*message.EnterBid).Money
+	max := g.maxPachiBid(name)
+	if bid < 0 || bid > max {
+		e := server.EncodeServerMessage(&message.ServerError{Error: fmt.Sprintf("Bid must be between 0 and %v", max), Code: 2002})
+		g.room.MessagePlayer(e, name)
+		return nil
+	}
+	g.quesState.pachiBid = bid
+
+	// Nobody else may answer, so skip straight to the selecting player
+	// answering.
+	snap := g.quesState.question.Snapshot()
+	g.room.MessagePlayers(server.EncodeServerMessage(snap.ToQuestionPrompt(false)))
+	g.room.MessageHost(server.EncodeServerMessage(snap.ToQuestionPrompt(true)))
+
+	g.gameState.currentStatus = STATUS_PLAYERS_ANSWERING
+	g.quesState.questionOpened = time.Now()
+	g.startAnswerTimer()
+	g.gameState.answerAttempt++
+	answering := &message.PlayerAnswering{
+		Name:     name,
+		Interval: int(g.config.AnswerTime.Seconds() * 1000),
+		Attempt:  g.gameState.answerAttempt,
+	}
+	g.room.MessageAll(server.EncodeServerMessage(answering))
+	return nil
+}
+
 func (g *GameDriver) OnAdjustScoreMessage(name string, host bool, msg message.ClientMessage) error {
 	g.gameState.mu.Lock()
 	defer g.gameState.mu.Unlock()
@@ -521,7 +843,7 @@ func (g *GameDriver) OnAdjustScoreMessage(name string, host bool, msg message.Cl
 		g.metagame.sendUpdatePlayers()
 	} else {
 		e := server.EncodeServerMessage(&message.ServerError{Error: "Player not found", Code: 3001})
-		g.server.MessagePlayer(e, name)
+		g.room.MessagePlayer(e, name)
 		log.Printf("Adjust score: player not found: %v", adj.PlayerName)
 	}
 	return nil
@@ -566,10 +888,61 @@ func (g *GameDriver) OnFreeformAnswerAddAnswerOwari(name string, host bool, msg
 	return nil
 }
 
+func (g *GameDriver) OnMarkOwariAnswerMessageScore(name string, host bool, msg message.ClientMessage) error {
+	g.gameState.mu.Lock()
+	defer g.gameState.mu.Unlock()
+
+	if !host {
+		return nil
+	}
+
+	if g.gameState.currentStatus != STATUS_SHOWING_OWARI {
+		return nil
+	}
+
+	mark := msg.Data.(*message.MarkOwariAnswer)
+
+	bid, ok := g.owariState.bids[mark.Name]
+	if !ok {
+		e := server.EncodeServerMessage(&message.ServerError{Error: "Player did not bid in Owari", Code: 2004})
+		g.room.MessagePlayer(e, name)
+		return nil
+	}
+	if _, ok := g.owariState.marked[mark.Name]; ok {
+		e := server.EncodeServerMessage(&message.ServerError{Error: "Answer has already been marked", Code: 2005})
+		g.room.MessagePlayer(e, name)
+		return nil
+	}
+
+	g.owariState.marked[mark.Name] = mark.Correct
+	if ply, ok := g.metagame.players[mark.Name]; ok {
+		if mark.Correct {
+			ply.Money += bid
+		} else {
+			ply.Money -= bid
+		}
+	}
+
+	reveal := &message.RevealOwariAnswer{
+		Name:    mark.Name,
+		Answer:  g.owariState.answers[mark.Name],
+		Bid:     bid,
+		Correct: mark.Correct,
+	}
+	g.room.MessageAll(server.EncodeServerMessage(reveal))
+	g.metagame.sendUpdatePlayers()
+
+	return nil
+}
+
 func (g *GameDriver) TimedSelectPlayerToAnswer() error {
 	g.gameState.mu.Lock()
 	defer g.gameState.mu.Unlock()
 
+	if g.gameState.currentStatus != STATUS_PLAYERS_BUZZING {
+		return nil
+	}
+
 	var ply string
 	lowest := math.MaxInt32
 	for p, d := range g.quesState.attemptedBuzzes {
@@ -585,11 +958,35 @@ func (g *GameDriver) TimedSelectPlayerToAnswer() error {
 
 	g.gameState.currentStatus = STATUS_PLAYERS_ANSWERING
 	g.quesState.playerAnswering = ply
+	g.startAnswerTimer()
+	g.gameState.answerAttempt++
 	answering := &message.PlayerAnswering{
 		Name:     ply,
 		Interval: int(g.config.AnswerTime.Seconds() * 1000),
+		Attempt:  g.gameState.answerAttempt,
+	}
+	g.room.MessageAll(server.EncodeServerMessage(answering))
+	return nil
+}
+
+// TimedAnswerExpired handles the player given by name running out of time to
+// answer the question in q, either marking them incorrect or alerting the host,
+// depending on the configuration.
+func (g *GameDriver) TimedAnswerExpired(q *questionPromptState, name string) error {
+	g.gameState.mu.Lock()
+	defer g.gameState.mu.Unlock()
+
+	if g.gameState.currentStatus != STATUS_PLAYERS_ANSWERING || g.quesState != q || q.playerAnswering != name {
+		return nil
+	}
+
+	switch g.config.AnswerTimeoutAction {
+	case ANSWER_TIMEOUT_MARK_INCORRECT:
+		log.Printf("%v ran out of time to answer, marking incorrect", name)
+		g.markAnswer(false)
+	case ANSWER_TIMEOUT_ALERT_HOST:
+		g.room.MessageHost(server.EncodeServerMessage(&message.AnswerTimeExpired{Name: name}))
 	}
-	g.server.MessageAll(server.EncodeServerMessage(answering))
 	return nil
 }
 
@@ -597,18 +994,39 @@ func (g *GameDriver) TimedTimeOutBuzzing() error {
 	g.gameState.mu.Lock()
 	defer g.gameState.mu.Unlock()
 
-	g.gameState.currentStatus = STATUS_POST_QUESTION
+	if g.gameState.currentStatus != STATUS_PLAYERS_BUZZING {
+		return nil
+	}
 
-	g.server.MessageAll(server.EncodeServerMessage(&message.CloseResponses{}))
+	// A tiebreaker question nobody answered is discarded for a fresh one.
+	if g.inTiebreaker() {
+		g.gameState.currentStatus = STATUS_TIEBREAKER
+	} else {
+		g.gameState.currentStatus = STATUS_POST_QUESTION
+	}
+
+	g.room.MessageAll(server.EncodeServerMessage(&message.CloseResponses{}))
 	return nil
 }
 
+// stopTimers stops the timers of the question being played, if any.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) stopTimers() {
+	if g.quesState != nil {
+		for _, t := range g.quesState.timers() {
+			t.Stop()
+		}
+	}
+}
+
 func (g *GameDriver) EndGame() {
 	g.gameState.mu.Lock()
 	defer g.gameState.mu.Unlock()
 
 	log.Print("Cancelling game!")
 
+	g.stopTimers()
+
 	g.gameState.currentStatus = STATUS_PRESTART
 
 	for _, p := range g.metagame.players {
@@ -619,70 +1037,105 @@ func (g *GameDriver) EndGame() {
 
 	g.sendUpdateBoard()
 
-	g.server.MessageAll(server.EncodeServerMessage(&message.ClearBoard{}))
+	g.room.MessageAll(server.EncodeServerMessage(&message.ClearBoard{}))
 
 	g.listenerManager.ClearListeners()
+	g.discardSave()
 }
 
 type timedFunc func() error
 
-// Functions scheduled to run after should re-obtain mutexes, as they are run
-// asynchronously to the caller.
-func runAfter(d time.Duration, f timedFunc) {
-	go func(d time.Duration, f timedFunc) {
-		<-time.After(d)
-		err := f()
-		if err != nil {
-			log.Printf("Error running timed function: %v", err)
-		}
-	}(d, f)
+// gameTimer runs a function once after a delay, and can be paused and resumed
+// while keeping the time that was remaining. gameTimers should only be used
+// while holding mu, the GameState mutex.
+type gameTimer struct {
+	f     timedFunc
+	timer *time.Timer
+	mu    sync.Locker
+
+	started   time.Time
+	remaining time.Duration
+	paused    bool
+	stopped   bool
+	// fired is set once f has been run, after which the timer does nothing.
+	fired bool
 }
 
-type unlessFunc func()
+// startTimer runs f after d, unless the timer is stopped first. mu must be held
+// by the caller, and is held by the timer while deciding whether to run f.
+// Functions scheduled to run should re-obtain mutexes, as they are run
+// asynchronously to the caller, and should check that the game is still in the
+// expected state.
+func startTimer(mu sync.Locker, d time.Duration, f timedFunc) *gameTimer {
+	t := &gameTimer{f: f, mu: mu, remaining: d}
+	t.start()
+	return t
+}
 
-// runAfterUnless runs a given function after the delay in d, unless returned
-// function returned is called, in which case it will do nothing.
-func runAfterUnless(d time.Duration, f timedFunc) unlessFunc {
-	u := make(chan bool, 100)
-	go func(d time.Duration, f timedFunc) {
-		select {
-		case <-u:
+func (t *gameTimer) start() {
+	t.started = time.Now()
+	t.timer = time.AfterFunc(t.remaining, func() {
+		// The timer may have been paused or stopped as it fired, in which
+		// case f is left to run when it's resumed, or not at all.
+		t.mu.Lock()
+		if t.fired || t.paused || t.stopped {
+			t.mu.Unlock()
 			return
-		case <-time.After(d):
-			err := f()
-			if err != nil {
-				log.Printf("Error running timed unless function: %v", err)
-			}
 		}
-	}(d, f)
-	return func() {
-		u <- true
+		t.fired = true
+		t.mu.Unlock()
+
+		if err := t.f(); err != nil {
+			log.Printf("Error running timed function: %v", err)
+		}
+	})
+}
+
+// Stop cancels the timer. Calling Stop on a nil timer does nothing.
+func (t *gameTimer) Stop() {
+	if t == nil || t.stopped || t.fired {
+		return
 	}
+	t.stopped = true
+	t.timer.Stop()
 }
 
-func NewGameDriver(s *server.Server, game *Game, lm *server.ListenerManager, config Configuration, metagame *MetaGameDriver) *GameDriver {
-	gs := game.CreateState()
-	driver := &GameDriver{
-		server:          s,
-		gameState:       gs,
-		config:          config,
-		listenerManager: lm,
-		owariState:      &owariState{bids: make(map[string]int), answers: make(map[string]string)},
-		metagame:        metagame,
+// Pause suspends the timer, saving the time remaining. Timers that have
+// already fired are left alone.
+func (t *gameTimer) Pause() {
+	if t == nil || t.stopped || t.fired || t.paused {
+		return
 	}
+	t.remaining = t.Remaining()
+	t.paused = true
+	t.timer.Stop()
+}
 
-	lm.RegisterJoin(driver.OnJoinSendBoard)
-	lm.RegisterJoin(driver.OnJoinShowQuestionPrompt)
-	lm.RegisterLeave(driver.OnLeaveStopAnswering)
-	lm.RegisterMessage("SelectQuestion", driver.OnSelectQuestionMessageShowQuestion)
-	lm.RegisterMessage("FinishReading", driver.OnFinishReadingMessageBeginCountdown)
-	lm.RegisterMessage("AttemptAnswer", driver.OnAttemptAnswerMessageAllowAnswer)
-	lm.RegisterMessage("MarkAnswer", driver.OnMarkAnswerMessageMoveAlong)
-	lm.RegisterMessage("MoveOn", driver.OnMoveOnMessageShowBoard)
-	lm.RegisterMessage("NextRound", driver.OnNextRoundMessageAdvanceRound)
-	lm.RegisterMessage("EnterBid", driver.OnEnterBidAddBid)
-	lm.RegisterMessage("FreeformAnswer", driver.OnFreeformAnswerAddAnswerOwari)
-	lm.RegisterMessage("AdjustScore", driver.OnAdjustScoreMessage)
+// Resume restarts a paused timer with the time that was remaining.
+func (t *gameTimer) Resume() {
+	if t == nil || t.stopped || t.fired || !t.paused {
+		return
+	}
+	t.paused = false
+	t.start()
+}
+
+// Remaining returns the time left before the timer fires.
+func (t *gameTimer) Remaining() time.Duration {
+	if t == nil || t.stopped || t.fired {
+		return 0
+	}
+	if t.paused {
+		return t.remaining
+	}
+	if r := t.remaining - time.Since(t.started); r > 0 {
+		return r
+	}
+	return 0
+}
+
+func NewGameDriver(r *server.Room, game *Game, lm *server.ListenerManager, config Configuration, metagame *MetaGameDriver) *GameDriver {
+	driver := newGameDriver(r, game.CreateState(), lm, config, metagame)
 
 	switch config.StartingPhase {
 	case "daini":
@@ -703,20 +1156,58 @@ func NewGameDriver(s *server.Server, game *Game, lm *server.ListenerManager, con
 	return driver
 }
 
+// newGameDriver creates a GameDriver that plays the game in gs, and registers
+// its listeners.
+func newGameDriver(r *server.Room, gs *GameState, lm *server.ListenerManager, config Configuration, metagame *MetaGameDriver) *GameDriver {
+	driver := &GameDriver{
+		room:            r,
+		gameState:       gs,
+		config:          config,
+		listenerManager: lm,
+		owariState:      &owariState{bids: make(map[string]int), answers: make(map[string]string), marked: make(map[string]bool)},
+		metagame:        metagame,
+		history:         metagame.generator.History(),
+		saver:           newSaver(),
+	}
+	go driver.saveInBackground()
+
+	lm.RegisterJoin(driver.OnJoinSendBoard)
+	lm.RegisterJoin(driver.OnJoinShowQuestionPrompt)
+	lm.RegisterLeave(driver.persistedLeave(driver.OnLeaveStopAnswering))
+	lm.RegisterMessage("SelectQuestion", driver.persisted(driver.OnSelectQuestionMessageShowQuestion))
+	lm.RegisterMessage("FinishReading", driver.persisted(driver.OnFinishReadingMessageBeginCountdown))
+	// Buzzes aren't saved, since a question in progress isn't resumed when a
+	// game is restored, and saving would slow down the buzzers.
+	lm.RegisterMessage("AttemptAnswer", driver.OnAttemptAnswerMessageAllowAnswer)
+	lm.RegisterMessage("MarkAnswer", driver.persisted(driver.OnMarkAnswerMessageMoveAlong))
+	lm.RegisterMessage("MoveOn", driver.persisted(driver.OnMoveOnMessageShowBoard))
+	lm.RegisterMessage("MoveOn", driver.persisted(driver.OnMoveOnMessageConcludeGame))
+	lm.RegisterMessage("NextRound", driver.persisted(driver.OnNextRoundMessageAdvanceRound))
+	lm.RegisterMessage("EnterBid", driver.persisted(driver.OnEnterBidAddBid))
+	lm.RegisterMessage("EnterBid", driver.persisted(driver.OnEnterBidPachiBid))
+	lm.RegisterMessage("FreeformAnswer", driver.persisted(driver.OnFreeformAnswerAddAnswerOwari))
+	lm.RegisterMessage("MarkOwariAnswer", driver.persisted(driver.OnMarkOwariAnswerMessageScore))
+	lm.RegisterMessage("AdjustScore", driver.persisted(driver.OnAdjustScoreMessage))
+	lm.RegisterMessage("Pause", driver.persisted(driver.OnPauseMessagePause))
+	lm.RegisterMessage("Resume", driver.persisted(driver.OnResumeMessageResume))
+
+	return driver
+}
+
 // StartGames starts the game play, requires the name of the player that
-// requested the start.
-func (g *GameDriver) StartGame(name string) error {
+// requested the start. Returns whether the game was started.
+func (g *GameDriver) StartGame(name string) bool {
 	g.gameState.mu.Lock()
 	defer g.gameState.mu.Unlock()
 
 	if g.gameState.currentStatus != STATUS_PRESTART {
-		return nil
+		return false
 	}
 
 	if len(g.metagame.players) == 0 {
 		e := server.EncodeServerMessage(&message.ServerError{Error: "Please wait for players to join before starting", Code: 2001})
-		g.server.MessagePlayer(e, name)
-		return nil
+		g.room.MessagePlayer(e, name)
+		return false
 	}
 
 	// Select a random player to begin selecting a question
@@ -744,5 +1235,5 @@ func (g *GameDriver) StartGame(name string) error {
 
 	//g.gameState.currentStatus = STATUS_SHOWING_BOARD
 
-	return nil
+	return true
 }
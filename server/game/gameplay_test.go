@@ -0,0 +1,392 @@
+package game
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baconstrip/kiken/common"
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/question"
+	"github.com/baconstrip/kiken/server"
+)
+
+// newTestGame starts a game hosted by "host" and played by players, on boards
+// with the categories "first" and "second" in daiichi, "third" in daini, "last"
+// in owari, and "extra" and "spare" in the tiebreaker. Timers that aren't set in config are too long to fire
+// during a test, so they're run by calling the timed functions.
+func newTestGame(t *testing.T, config Configuration, players ...string) *GameDriver {
+	t.Helper()
+	r, err := server.New("", server.Credentials{}, 0, nil).CreateRoom("test")
+	if err != nil {
+		t.Fatalf("CreateRoom() failed: %v", err)
+	}
+	for _, d := range []*time.Duration{&config.ChanceTime, &config.DisambiguationTime, &config.AnswerTime} {
+		if *d == 0 {
+			*d = time.Hour
+		}
+	}
+
+	m := NewMetaGameDriver(NewBoardGenerator(nil, GeneratorOptions{}, nil), nil, r, config)
+	m.host = &PlayerStats{Name: "host", Connected: true}
+	for _, name := range players {
+		m.players[name] = &PlayerStats{Name: name, Connected: true}
+	}
+	game := New(
+		NewBoard(common.DAIICHI,
+			testCategory("first", common.DAIICHI, 200, 400, 600, 800, 1000),
+			testCategory("second", common.DAIICHI, 200, 400, 600, 800, 1000)),
+		NewBoard(common.DAINI, testCategory("third", common.DAINI, 400, 800, 1200, 1600, 2000)),
+		NewBoard(common.OWARI, testCategory("last", common.OWARI, 0)),
+		NewBoard(common.TIEBREAKER,
+			testCategory("extra", common.TIEBREAKER, 0),
+			testCategory("spare", common.TIEBREAKER, 0)))
+	g := NewGameDriver(r, game, server.NewListenerManager(), config, m)
+	m.gameDriver = g
+	if !g.StartGame("host") {
+		t.Fatalf("StartGame() didn't start the game")
+	}
+	t.Cleanup(func() {
+		g.gameState.mu.Lock()
+		g.stopTimers()
+		g.gameState.mu.Unlock()
+		g.saver.stop()
+	})
+	return g
+}
+
+// send runs the listener handle as though name sent msg, and fails the test if
+// it returns an error.
+func send(t *testing.T, handle server.ClientMessageListener, name string, host bool, msg interface{}) {
+	t.Helper()
+	if err := handle(name, host, message.ClientMessage{Data: msg}); err != nil {
+		t.Fatalf("Handling %T from %v failed: %v", msg, name, err)
+	}
+}
+
+// buzzIn selects the question with ID id from the board, and plays it up to
+// the player named name answering it.
+func buzzIn(t *testing.T, g *GameDriver, id, name string) {
+	t.Helper()
+	send(t, g.OnSelectQuestionMessageShowQuestion, "host", true, &message.SelectQuestion{ID: id})
+	send(t, g.OnFinishReadingMessageBeginCountdown, "host", true, &message.FinishReading{})
+	send(t, g.OnAttemptAnswerMessageAllowAnswer, name, false, &message.AttemptAnswer{ResponseTime: 100})
+	if err := g.TimedSelectPlayerToAnswer(); err != nil {
+		t.Fatalf("TimedSelectPlayerToAnswer() failed: %v", err)
+	}
+	if g.gameState.currentStatus != STATUS_PLAYERS_ANSWERING || g.quesState.playerAnswering != name {
+		t.Fatalf("%v isn't answering %v, status %v", name, id, g.gameState.currentStatus)
+	}
+}
+
+func TestGameTimerPauseResume(t *testing.T) {
+	var mu sync.Mutex
+	fired := make(chan bool, 1)
+	mu.Lock()
+	timer := startTimer(&mu, 50*time.Millisecond, func() error {
+		fired <- true
+		return nil
+	})
+
+	timer.Pause()
+	remaining := timer.Remaining()
+	mu.Unlock()
+	if remaining <= 0 || remaining > 50*time.Millisecond {
+		t.Fatalf("Remaining() after Pause() = %v, want between 0 and 50ms", remaining)
+	}
+
+	select {
+	case <-fired:
+		t.Fatalf("paused timer fired")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	mu.Lock()
+	if got := timer.Remaining(); got != remaining {
+		t.Errorf("Remaining() changed while paused, got %v, want %v", got, remaining)
+	}
+	timer.Resume()
+	mu.Unlock()
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatalf("resumed timer did not fire")
+	}
+}
+
+func TestGameTimerFiresOnce(t *testing.T) {
+	var mu sync.Mutex
+	fired := make(chan bool, 2)
+	mu.Lock()
+	timer := startTimer(&mu, 10*time.Millisecond, func() error {
+		fired <- true
+		return nil
+	})
+	mu.Unlock()
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatalf("timer did not fire")
+	}
+
+	// Pausing and resuming a timer that's already fired mustn't run it again.
+	mu.Lock()
+	timer.Pause()
+	timer.Resume()
+	mu.Unlock()
+	select {
+	case <-fired:
+		t.Fatalf("timer fired again after being paused and resumed")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestGameTimerStop(t *testing.T) {
+	var mu sync.Mutex
+	fired := make(chan bool, 1)
+	mu.Lock()
+	timer := startTimer(&mu, 10*time.Millisecond, func() error {
+		fired <- true
+		return nil
+	})
+	timer.Stop()
+	timer.Resume()
+	mu.Unlock()
+
+	select {
+	case <-fired:
+		t.Fatalf("stopped timer fired")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	var nilTimer *gameTimer
+	nilTimer.Stop()
+	if got := nilTimer.Remaining(); got != 0 {
+		t.Errorf("Remaining() on nil timer = %v, want 0", got)
+	}
+}
+
+func TestCoHostMarks(t *testing.T) {
+	g := newTestGame(t, Configuration{}, "alice", "bob")
+	g.metagame.coHosts["cohost"] = &PlayerStats{Name: "cohost", Connected: true}
+	buzzIn(t, g, "first200", "alice")
+
+	// Co-hosts can't mark without saying which attempt they're marking.
+	send(t, g.OnMarkAnswerMessageMoveAlong, "cohost", true, &message.MarkAnswer{Correct: false})
+	if g.gameState.currentStatus != STATUS_PLAYERS_ANSWERING {
+		t.Fatalf("co-host's mark without an attempt was accepted")
+	}
+	attempt := g.gameState.answerAttempt
+	send(t, g.OnMarkAnswerMessageMoveAlong, "cohost", true, &message.MarkAnswer{Correct: false, Attempt: attempt})
+	if g.gameState.currentStatus != STATUS_PLAYERS_BUZZING {
+		t.Fatalf("co-host's mark of the current attempt wasn't accepted")
+	}
+
+	// The host's mark of the same attempt comes too late, but the host in
+	// control may mark the next one without saying which it is.
+	send(t, g.OnAttemptAnswerMessageAllowAnswer, "bob", false, &message.AttemptAnswer{ResponseTime: 100})
+	if err := g.TimedSelectPlayerToAnswer(); err != nil {
+		t.Fatalf("TimedSelectPlayerToAnswer() failed: %v", err)
+	}
+	send(t, g.OnMarkAnswerMessageMoveAlong, "host", true, &message.MarkAnswer{Correct: true, Attempt: attempt})
+	if g.gameState.currentStatus != STATUS_PLAYERS_ANSWERING {
+		t.Fatalf("host's mark of an attempt that was already marked was accepted")
+	}
+	send(t, g.OnMarkAnswerMessageMoveAlong, "host", true, &message.MarkAnswer{Correct: true})
+	if bob := g.metagame.players["bob"]; bob.Money != 200 {
+		t.Errorf("bob has %v after the host marked them correct, want 200", bob.Money)
+	}
+}
+
+func TestAnswerTimeoutMarksIncorrect(t *testing.T) {
+	g := newTestGame(t, Configuration{AnswerTimeoutAction: ANSWER_TIMEOUT_MARK_INCORRECT}, "alice", "bob")
+	buzzIn(t, g, "first200", "alice")
+
+	if err := g.TimedAnswerExpired(g.quesState, "alice"); err != nil {
+		t.Fatalf("TimedAnswerExpired() failed: %v", err)
+	}
+	if g.gameState.currentStatus != STATUS_PLAYERS_BUZZING {
+		t.Errorf("status after running out of time = %v, want %v", g.gameState.currentStatus, STATUS_PLAYERS_BUZZING)
+	}
+	if alice := g.metagame.players["alice"]; alice.Money != -200 {
+		t.Errorf("alice has %v after running out of time, want -200", alice.Money)
+	}
+
+	// Running out of time on an attempt that's already over does nothing.
+	if err := g.TimedAnswerExpired(g.quesState, "alice"); err != nil {
+		t.Fatalf("TimedAnswerExpired() failed: %v", err)
+	}
+	if alice := g.metagame.players["alice"]; alice.Money != -200 {
+		t.Errorf("alice has %v after a stale timeout, want -200", alice.Money)
+	}
+}
+
+func TestAnswerTimeoutAlertsHost(t *testing.T) {
+	g := newTestGame(t, Configuration{AnswerTimeoutAction: ANSWER_TIMEOUT_ALERT_HOST, AnswerTime: 10 * time.Millisecond}, "alice", "bob")
+	buzzIn(t, g, "first200", "alice")
+
+	// Wait for the answer timer to run out. The host is left to mark the
+	// answer.
+	deadline := time.Now().Add(time.Second)
+	for {
+		g.gameState.mu.Lock()
+		fired := g.quesState.answerTimer.fired
+		g.gameState.mu.Unlock()
+		if fired {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("answer timer never ran out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	g.gameState.mu.Lock()
+	if g.gameState.currentStatus != STATUS_PLAYERS_ANSWERING {
+		t.Errorf("status after running out of time = %v, want %v", g.gameState.currentStatus, STATUS_PLAYERS_ANSWERING)
+	}
+	runs := 0
+	g.quesState.answerTimer.f = func() error {
+		runs++
+		return nil
+	}
+	g.gameState.mu.Unlock()
+
+	// Pausing and resuming mustn't alert the host again.
+	send(t, g.OnPauseMessagePause, "host", true, &message.Pause{})
+	send(t, g.OnResumeMessageResume, "host", true, &message.Resume{})
+	time.Sleep(50 * time.Millisecond)
+	g.gameState.mu.Lock()
+	defer g.gameState.mu.Unlock()
+	if runs != 0 {
+		t.Errorf("answer timer ran %v more times after pausing and resuming, want 0", runs)
+	}
+}
+
+// selectPachi makes the question with ID id a pachi question, and has the
+// player named selector, with money, select it.
+func selectPachi(t *testing.T, g *GameDriver, id, selector string, money int) {
+	t.Helper()
+	for name, ply := range g.metagame.players {
+		ply.Selecting = name == selector
+	}
+	g.metagame.players[selector].Money = money
+	b := g.gameState.CurrentBoard().data
+	b.pachi = []*question.Question{g.gameState.FindQuestion(id).Data}
+	send(t, g.OnSelectQuestionMessageShowQuestion, "host", true, &message.SelectQuestion{ID: id})
+}
+
+func TestBeginPachi(t *testing.T) {
+	g := newTestGame(t, Configuration{}, "alice", "bob")
+	selectPachi(t, g, "first600", "alice", 0)
+
+	if g.gameState.currentStatus != STATUS_ACCEPTING_PACHI_BID {
+		t.Fatalf("status after selecting a pachi question = %v, want %v", g.gameState.currentStatus, STATUS_ACCEPTING_PACHI_BID)
+	}
+	if !g.quesState.pachi || g.quesState.playerAnswering != "alice" {
+		t.Errorf("pachi question is for %q, want alice", g.quesState.playerAnswering)
+	}
+	if q := g.gameState.FindQuestion("first600"); !q.Played {
+		t.Errorf("pachi question wasn't marked played")
+	}
+
+	// Only the player who selected the question may wager on it.
+	send(t, g.OnEnterBidPachiBid, "bob", false, &message.EnterBid{Money: 200})
+	if g.gameState.currentStatus != STATUS_ACCEPTING_PACHI_BID {
+		t.Errorf("bid from a player who didn't select the question was accepted")
+	}
+	send(t, g.OnEnterBidPachiBid, "alice", false, &message.EnterBid{Money: 200})
+	if g.gameState.currentStatus != STATUS_PLAYERS_ANSWERING || g.quesState.pachiBid != 200 {
+		t.Fatalf("after alice's bid, status %v with bid %v, want %v with 200", g.gameState.currentStatus, g.quesState.pachiBid, STATUS_PLAYERS_ANSWERING)
+	}
+}
+
+func TestPachiWithNobodySelecting(t *testing.T) {
+	g := newTestGame(t, Configuration{}, "alice", "bob")
+	g.gameState.CurrentBoard().data.pachi = []*question.Question{g.gameState.FindQuestion("first600").Data}
+	for _, ply := range g.metagame.players {
+		ply.Selecting = false
+	}
+	send(t, g.OnSelectQuestionMessageShowQuestion, "host", true, &message.SelectQuestion{ID: "first600"})
+	if g.gameState.currentStatus != STATUS_PRESENTING_QUESTION || g.quesState.pachi {
+		t.Errorf("pachi question with nobody selecting has status %v, want it played as a normal question", g.gameState.currentStatus)
+	}
+}
+
+func TestPachiBid(t *testing.T) {
+	tests := []struct {
+		name    string
+		money   int
+		bid     int
+		correct bool
+		// valid is whether the bid should be accepted.
+		valid     bool
+		wantMoney int
+	}{
+		{
+			name:      "Up to the top value with a low score, correct",
+			money:     200,
+			bid:       1000,
+			correct:   true,
+			valid:     true,
+			wantMoney: 1200,
+		},
+		{
+			name:  "Over the top value with a low score",
+			money: 200,
+			bid:   1001,
+		},
+		{
+			name:      "Up to the score above the top value, incorrect",
+			money:     3000,
+			bid:       3000,
+			valid:     true,
+			wantMoney: 0,
+		},
+		{
+			name:  "Over the score above the top value",
+			money: 3000,
+			bid:   3001,
+		},
+		{
+			name:      "Nothing with a negative score, incorrect",
+			money:     -400,
+			bid:       0,
+			valid:     true,
+			wantMoney: -400,
+		},
+		{
+			name:  "Negative",
+			money: 200,
+			bid:   -1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := newTestGame(t, Configuration{}, "alice", "bob")
+			selectPachi(t, g, "first600", "alice", test.money)
+
+			send(t, g.OnEnterBidPachiBid, "alice", false, &message.EnterBid{Money: test.bid})
+			if !test.valid {
+				if g.gameState.currentStatus != STATUS_ACCEPTING_PACHI_BID || g.quesState.pachiBid != 0 {
+					t.Errorf("bid of %v with %v was accepted, status %v", test.bid, test.money, g.gameState.currentStatus)
+				}
+				return
+			}
+			if g.gameState.currentStatus != STATUS_PLAYERS_ANSWERING {
+				t.Fatalf("bid of %v with %v wasn't accepted, status %v", test.bid, test.money, g.gameState.currentStatus)
+			}
+
+			send(t, g.OnMarkAnswerMessageMoveAlong, "host", true, &message.MarkAnswer{Correct: test.correct, Attempt: g.gameState.answerAttempt})
+			if g.gameState.currentStatus != STATUS_POST_QUESTION {
+				t.Errorf("status after marking the pachi question = %v, want %v", g.gameState.currentStatus, STATUS_POST_QUESTION)
+			}
+			if got := g.metagame.players["alice"].Money; got != test.wantMoney {
+				t.Errorf("alice has %v after the pachi question, want %v", got, test.wantMoney)
+			}
+			if got := g.metagame.players["bob"].Money; got != 0 {
+				t.Errorf("bob has %v after alice's pachi question, want 0", got)
+			}
+		})
+	}
+}
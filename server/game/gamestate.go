@@ -35,6 +35,13 @@ const (
 	STATUS_OWARI_AWAIT_ANSWERS
 	// Showing answers for Owari.
 	STATUS_SHOWING_OWARI
+	// Waiting on the selecting player to wager on a pachi question.
+	STATUS_ACCEPTING_PACHI_BID
+	// Players are tied after Owari, waiting on the host to present the next
+	// tiebreaker question.
+	STATUS_TIEBREAKER
+	// The game has finished.
+	STATUS_GAME_OVER
 )
 
 func (g *GameState) IsOwariState() bool {
@@ -67,6 +74,20 @@ type GameState struct {
 
 	currentRound  common.Round
 	currentStatus Status
+	// pausedStatus is the status play will resume at while the game is paused.
+	pausedStatus Status
+	// answerAttempt counts the attempts players have made to answer, to
+	// identify the one currently being answered.
+	answerAttempt int
+}
+
+// effectiveStatus returns the current status, or the status the game will
+// resume at if it's paused.
+func (g *GameState) effectiveStatus() Status {
+	if g.currentStatus == STATUS_PAUSED {
+		return g.pausedStatus
+	}
+	return g.currentStatus
 }
 
 func (g *GameState) Snapshot() *GameStateSnapshot {
@@ -78,12 +99,13 @@ func (g *GameState) Snapshot() *GameStateSnapshot {
 	return &GameStateSnapshot{
 		CurrentRound:  g.currentRound,
 		CurrentStatus: g.currentStatus,
+		PausedStatus:  g.pausedStatus,
 		Boards:        bsnaps,
 	}
 }
 
 func (g *GameState) CurrentBoard() *BoardState {
-	if g.currentRound == common.UNKNOWN {
+	if g.currentRound == common.UNKNOWN || int(g.currentRound) > len(g.Boards) {
 		return nil
 	}
 	return g.Boards[int(g.currentRound)-1]
@@ -129,15 +151,21 @@ func (b *BoardState) Snapshot() *BoardStateSnapshot {
 		snap := c.Snapshot()
 		csnaps = append(csnaps, *snap)
 	}
+	var pachi []string
+	for _, q := range b.data.pachi {
+		pachi = append(pachi, q.ID)
+	}
 	return &BoardStateSnapshot{
 		Categories: csnaps,
 		Round:      b.data.Round,
+		Pachi:      pachi,
 	}
 }
 
 type GameStateSnapshot struct {
 	CurrentRound  common.Round
 	CurrentStatus Status
+	PausedStatus  Status
 
 	Boards []BoardStateSnapshot
 }
@@ -145,8 +173,53 @@ type GameStateSnapshot struct {
 type BoardStateSnapshot struct {
 	Categories []question.CategoryStateSnapshot
 	Round      common.Round
-	// Snapshot does not include pachi, as they are never needed by the
-	// snapshot.
+	// Pachi contains the IDs of the pachi questions, and must never be sent to
+	// clients.
+	Pachi []string
+}
+
+// restore recreates the GameState the snapshot was taken from.
+func (g *GameStateSnapshot) restore() *GameState {
+	var boards []*Board
+	var bstates []*BoardState
+	for _, b := range g.Boards {
+		state := b.restore()
+		boards = append(boards, state.data)
+		bstates = append(bstates, state)
+	}
+	return &GameState{
+		data:          New(boards...),
+		Boards:        bstates,
+		currentRound:  g.CurrentRound,
+		currentStatus: g.CurrentStatus,
+		pausedStatus:  g.PausedStatus,
+	}
+}
+
+// restore recreates the BoardState the snapshot was taken from.
+func (b *BoardStateSnapshot) restore() *BoardState {
+	var categories []*question.Category
+	for _, c := range b.Categories {
+		categories = append(categories, c.ToCategory())
+	}
+	board := NewBoard(b.Round, categories...)
+	for _, id := range b.Pachi {
+		for _, c := range categories {
+			for _, q := range c.Questions {
+				if q.ID == id {
+					board.pachi = append(board.pachi, q)
+				}
+			}
+		}
+	}
+
+	state := board.state()
+	for i, c := range b.Categories {
+		for j, q := range c.Questions {
+			state.Categories[i].Questions[j].Played = q.Played
+		}
+	}
+	return state
 }
 
 func (b *BoardStateSnapshot) ToBoardOverview() *message.BoardOverview {
@@ -0,0 +1,262 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baconstrip/kiken/common"
+	"github.com/baconstrip/kiken/question"
+)
+
+// categoriesPerBoard is the number of categories on daiichi and daini boards.
+const categoriesPerBoard = 6
+
+// GeneratorOptions configures how a BoardGenerator makes games from the
+// question pool.
+type GeneratorOptions struct {
+	// Seed seeds the random choices, so that the same seed and questions always
+	// produce the same games. If zero, a seed is picked from the current time.
+	Seed int64
+	// AvoidRecent is the number of recently played games whose categories
+	// won't be used again, unless there aren't enough other categories.
+	AvoidRecent int
+	// MinShowing and MaxShowing restrict daiichi, daini, and Owari questions
+	// to those from a range of showings. Zero leaves that end of the range
+	// open. Tiebreaker questions are never restricted.
+	MinShowing int
+	MaxShowing int
+	// AvoidPlayed avoids questions recorded in the play history, unless there
+	// aren't enough others.
+	AvoidPlayed bool
+}
+
+// BoardGenerator makes games by sampling categories at random from the
+// question pool. It's shared by every room, so that categories recently played
+// in any room are avoided.
+type BoardGenerator struct {
+	mu sync.Mutex
+
+	options GeneratorOptions
+	rand    *rand.Rand
+	history *PlayHistory
+
+	// categories holds the full categories in the pool for each round, sorted
+	// by name so that a seed always produces the same game.
+	categories map[common.Round][]*question.Category
+	tiebreaker []*question.Category
+
+	// recent holds the category names used by each recently played game,
+	// oldest first.
+	recent [][]string
+}
+
+// NewBoardGenerator creates a BoardGenerator that makes games from questions.
+// history may be nil if played questions aren't tracked.
+func NewBoardGenerator(questions []*question.Question, options GeneratorOptions, history *PlayHistory) *BoardGenerator {
+	seed := options.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	var inRange []*question.Question
+	for _, q := range questions {
+		if options.MinShowing > 0 && q.Showing < options.MinShowing {
+			continue
+		}
+		if options.MaxShowing > 0 && q.Showing > options.MaxShowing {
+			continue
+		}
+		inRange = append(inRange, q)
+	}
+
+	standard, err := question.CollateFullCategories(inRange, true)
+	if err != nil {
+		log.Printf("Failed to create categories from questions: %v", err)
+	}
+
+	categories := make(map[common.Round][]*question.Category)
+	for _, c := range standard {
+		categories[c.Round] = append(categories[c.Round], c)
+	}
+	categories[common.OWARI] = question.CollateLoneQuestions(inRange, common.OWARI)
+	for _, cats := range categories {
+		sortCategories(cats)
+	}
+	tiebreaker := question.CollateLoneQuestions(questions, common.TIEBREAKER)
+	sortCategories(tiebreaker)
+
+	log.Printf("Board generator has %v daiichi, %v daini, %v Owari, and %v tiebreaker categories", len(categories[common.DAIICHI]), len(categories[common.DAINI]), len(categories[common.OWARI]), len(tiebreaker))
+
+	return &BoardGenerator{
+		options:    options,
+		rand:       rand.New(rand.NewSource(seed)),
+		history:    history,
+		categories: categories,
+		tiebreaker: tiebreaker,
+	}
+}
+
+// History returns the history of played questions the generator avoids.
+func (b *BoardGenerator) History() *PlayHistory {
+	return b.history
+}
+
+func sortCategories(cats []*question.Category) {
+	sort.SliceStable(cats, func(i, j int) bool {
+		return cats[i].Name < cats[j].Name
+	})
+}
+
+// categoryKey identifies categories by name, so that the same category from
+// different showings is treated as a repeat.
+func categoryKey(c *question.Category) string {
+	return strings.ToLower(strings.TrimSpace(c.Name))
+}
+
+// recentCategories returns the names of the categories used by recently played
+// games.
+// Callers must obtain a mutex before calling.
+func (b *BoardGenerator) recentCategories() map[string]bool {
+	recent := make(map[string]bool)
+	for _, names := range b.recent {
+		for _, n := range names {
+			recent[n] = true
+		}
+	}
+	return recent
+}
+
+// seen returns whether any question in c has been played before, if played
+// questions are being avoided.
+func (b *BoardGenerator) seen(c *question.Category) bool {
+	if !b.options.AvoidPlayed {
+		return false
+	}
+	for _, q := range c.Questions {
+		if b.history.Played(q.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// sample picks count categories at random from cats, skipping any in used and
+// preferring those not in recent that haven't been seen. Picked categories are
+// added to used.
+// Callers must obtain a mutex before calling.
+func (b *BoardGenerator) sample(cats []*question.Category, count int, used, recent map[string]bool) []*question.Category {
+	var fresh, stale []*question.Category
+	for _, i := range b.rand.Perm(len(cats)) {
+		c := cats[i]
+		switch key := categoryKey(c); {
+		case used[key]:
+		case recent[key] || b.seen(c):
+			stale = append(stale, c)
+		default:
+			fresh = append(fresh, c)
+		}
+	}
+
+	picked := append(fresh, stale...)
+	if len(picked) > count {
+		picked = picked[:count]
+	}
+	for _, c := range picked {
+		used[categoryKey(c)] = true
+	}
+	return picked
+}
+
+// tiebreakerBoard creates a board of every tiebreaker question in the pool, in
+// random order, with questions that haven't been seen first.
+// Callers must obtain a mutex before calling.
+func (b *BoardGenerator) tiebreakerBoard() *Board {
+	var fresh, stale []*question.Category
+	for _, i := range b.rand.Perm(len(b.tiebreaker)) {
+		c := b.tiebreaker[i]
+		if b.seen(c) {
+			stale = append(stale, c)
+		} else {
+			fresh = append(fresh, c)
+		}
+	}
+	return NewBoard(common.TIEBREAKER, append(fresh, stale...)...)
+}
+
+// Generate makes a new game from the pool, with pachi questions picked.
+// Categories never repeat between daiichi and daini.
+func (b *BoardGenerator) Generate() (*Game, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	used := make(map[string]bool)
+	recent := b.recentCategories()
+
+	daiichi := b.sample(b.categories[common.DAIICHI], categoriesPerBoard, used, recent)
+	daini := b.sample(b.categories[common.DAINI], categoriesPerBoard, used, recent)
+	owari := b.sample(b.categories[common.OWARI], 1, used, recent)
+
+	if len(daiichi) == 0 || len(daini) == 0 || len(owari) == 0 {
+		return nil, fmt.Errorf("not enough questions to make a game, found %v daiichi, %v daini, and %v Owari categories", len(daiichi), len(daini), len(owari))
+	}
+
+	g := New(
+		NewBoard(common.DAIICHI, daiichi...),
+		NewBoard(common.DAINI, daini...),
+		NewBoard(common.OWARI, owari...),
+		b.tiebreakerBoard(),
+	)
+	pickPachi(g, b.rand)
+	return g, nil
+}
+
+// CompleteShow returns a game to play from a show's game, with pachi questions
+// picked. Shows don't need to include tiebreaker questions, so they're taken
+// from the pool if the show has none. The show's game is left unchanged, so
+// that it can be played again.
+func (b *BoardGenerator) CompleteShow(show *Game) *Game {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var boards []*Board
+	for _, board := range show.Boards {
+		boards = append(boards, board.clone())
+	}
+	if len(boards) < int(common.TIEBREAKER) {
+		boards = append(boards, b.tiebreakerBoard())
+	}
+	g := New(boards...)
+	pickPachi(g, b.rand)
+	return g
+}
+
+// RecordPlayed notes the categories of a game that has been played, so that
+// they are avoided by the following games.
+func (b *BoardGenerator) RecordPlayed(g *Game) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.options.AvoidRecent <= 0 {
+		return
+	}
+
+	var names []string
+	for _, board := range g.Boards {
+		if board.Round == common.TIEBREAKER {
+			continue
+		}
+		for _, c := range board.Categories {
+			names = append(names, categoryKey(c))
+		}
+	}
+
+	b.recent = append(b.recent, names)
+	if len(b.recent) > b.options.AvoidRecent {
+		b.recent = b.recent[len(b.recent)-b.options.AvoidRecent:]
+	}
+}
@@ -0,0 +1,195 @@
+package game
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/baconstrip/kiken/common"
+	"github.com/baconstrip/kiken/question"
+)
+
+// testPool creates a question pool with count full categories for each of
+// daiichi and daini, and count Owari questions, from the given showing.
+func testPool(showing, count int) []*question.Question {
+	var qs []*question.Question
+	for i := 0; i < count; i++ {
+		for _, round := range []common.Round{common.DAIICHI, common.DAINI} {
+			name := round.String() + "-" + strconv.Itoa(showing) + "-" + strconv.Itoa(i)
+			for _, v := range []int{1, 2, 3, 4, 5} {
+				qs = append(qs, &question.Question{
+					Category: name,
+					Value:    v * 200 * int(round),
+					Round:    round,
+					Showing:  showing,
+					ID:       name + strconv.Itoa(v),
+				})
+			}
+		}
+		name := "owari-" + strconv.Itoa(showing) + "-" + strconv.Itoa(i)
+		qs = append(qs, &question.Question{Category: name, Round: common.OWARI, Showing: showing, ID: name})
+	}
+	return qs
+}
+
+func categoryNames(g *Game) [][]string {
+	var names [][]string
+	for _, b := range g.Boards {
+		var round []string
+		for _, c := range b.Categories {
+			round = append(round, c.Name)
+		}
+		names = append(names, round)
+	}
+	return names
+}
+
+func TestGenerateIsReproducible(t *testing.T) {
+	pool := testPool(1, 20)
+
+	a, err := NewBoardGenerator(pool, GeneratorOptions{Seed: 42}, nil).Generate()
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	b, err := NewBoardGenerator(pool, GeneratorOptions{Seed: 42}, nil).Generate()
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(categoryNames(a), categoryNames(b)) {
+		t.Errorf("Generate() with the same seed made different games:\n%v\n%v", categoryNames(a), categoryNames(b))
+	}
+	for i := range a.Boards {
+		if !reflect.DeepEqual(a.Boards[i].pachi, b.Boards[i].pachi) {
+			t.Errorf("Generate() with the same seed picked different pachi questions for round %v", a.Boards[i].Round)
+		}
+	}
+}
+
+func TestGenerateShape(t *testing.T) {
+	pool := testPool(1, 20)
+	g, err := NewBoardGenerator(pool, GeneratorOptions{Seed: 1}, nil).Generate()
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	wantRounds := []common.Round{common.DAIICHI, common.DAINI, common.OWARI, common.TIEBREAKER}
+	wantCategories := []int{categoriesPerBoard, categoriesPerBoard, 1, 0}
+	if len(g.Boards) != len(wantRounds) {
+		t.Fatalf("Generate() made %v boards, want %v", len(g.Boards), len(wantRounds))
+	}
+	seen := make(map[string]bool)
+	for i, b := range g.Boards {
+		if b.Round != wantRounds[i] {
+			t.Errorf("board %v is round %v, want %v", i, b.Round, wantRounds[i])
+		}
+		if len(b.Categories) != wantCategories[i] {
+			t.Errorf("board %v has %v categories, want %v", i, len(b.Categories), wantCategories[i])
+		}
+		for _, c := range b.Categories {
+			if c.Round != b.Round {
+				t.Errorf("category %v from round %v placed on %v board", c.Name, c.Round, b.Round)
+			}
+			if seen[c.Name] {
+				t.Errorf("category %v used twice", c.Name)
+			}
+			seen[c.Name] = true
+		}
+	}
+}
+
+func TestGenerateShowingRange(t *testing.T) {
+	var pool []*question.Question
+	for showing := 1; showing <= 5; showing++ {
+		pool = append(pool, testPool(showing, 10)...)
+	}
+
+	gen := NewBoardGenerator(pool, GeneratorOptions{Seed: 1, MinShowing: 2, MaxShowing: 3}, nil)
+	for i := 0; i < 10; i++ {
+		g, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate() failed: %v", err)
+		}
+		for _, b := range g.Boards {
+			for _, c := range b.Categories {
+				for _, q := range c.Questions {
+					if q.Showing < 2 || q.Showing > 3 {
+						t.Errorf("Generate() used question %v from showing %v, outside of 2-3", q.ID, q.Showing)
+					}
+				}
+			}
+		}
+	}
+
+	if _, err := NewBoardGenerator(pool, GeneratorOptions{MinShowing: 10}, nil).Generate(); err == nil {
+		t.Errorf("Generate() with no questions in range succeeded")
+	}
+}
+
+func TestGenerateAvoidsRecent(t *testing.T) {
+	// Enough categories for two games, but not three.
+	pool := testPool(1, 2*categoriesPerBoard)
+	gen := NewBoardGenerator(pool, GeneratorOptions{Seed: 7, AvoidRecent: 1}, nil)
+
+	first, err := gen.Generate()
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	gen.RecordPlayed(first)
+
+	second, err := gen.Generate()
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	played := make(map[string]bool)
+	for _, round := range categoryNames(first)[:2] {
+		for _, name := range round {
+			played[name] = true
+		}
+	}
+	for _, round := range categoryNames(second)[:2] {
+		for _, name := range round {
+			if played[name] {
+				t.Errorf("Generate() reused category %v from the previous game", name)
+			}
+		}
+	}
+	gen.RecordPlayed(second)
+
+	// Only the last game is avoided, so the first game's categories are
+	// available again, and a full game can still be made.
+	third, err := gen.Generate()
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if got := len(third.Boards[0].Categories); got != categoriesPerBoard {
+		t.Errorf("Generate() made a daiichi board with %v categories, want %v", got, categoriesPerBoard)
+	}
+}
+
+func TestGenerateAvoidsPlayed(t *testing.T) {
+	pool := testPool(1, categoriesPerBoard+1)
+	history, err := LoadPlayHistory("")
+	if err != nil {
+		t.Fatalf("LoadPlayHistory() failed: %v", err)
+	}
+	// One clue from each of the first categories has been played, leaving
+	// exactly enough unseen categories for a board.
+	history.MarkPlayed("daiichi-1-01")
+	history.MarkPlayed("daini-1-13")
+
+	gen := NewBoardGenerator(pool, GeneratorOptions{Seed: 3, AvoidPlayed: true}, history)
+	for i := 0; i < 10; i++ {
+		g, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate() failed: %v", err)
+		}
+		for _, round := range categoryNames(g)[:2] {
+			for _, name := range round {
+				if name == "daiichi-1-0" || name == "daini-1-1" {
+					t.Errorf("Generate() used category %v with a played clue", name)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/server"
+	"github.com/baconstrip/kiken/util"
+)
+
+// PlayHistory records which questions have been played in any game, so that
+// generated games can avoid them. It's saved to a file in the background
+// whenever it changes. A nil PlayHistory records nothing.
+type PlayHistory struct {
+	mu sync.RWMutex
+
+	path string
+	// played maps the IDs of played questions to when they were first played.
+	played map[string]time.Time
+	// pending is set while a write has been started in the background but
+	// hasn't yet taken its copy of played.
+	pending bool
+
+	// writeMu is held while writing, so that writes are made one at a time,
+	// and an older copy of the history never replaces a newer one.
+	writeMu sync.Mutex
+}
+
+// LoadPlayHistory reads the history saved at path, or starts an empty history
+// if there is none. Changes are saved back to path, unless it's empty.
+func LoadPlayHistory(path string) (*PlayHistory, error) {
+	h := &PlayHistory{
+		path:   path,
+		played: make(map[string]time.Time),
+	}
+	if path == "" {
+		return h, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read play history: %v", err)
+	}
+	if err := json.Unmarshal(data, &h.played); err != nil {
+		return nil, fmt.Errorf("could not decode play history: %v", err)
+	}
+	return h, nil
+}
+
+// Flush writes the history to its path, if it has one, and waits for it to be
+// written.
+func (h *PlayHistory) Flush() error {
+	if h == nil {
+		return nil
+	}
+	return h.write(false)
+}
+
+// write writes the history to its path, if it has one. If onlyPending is set,
+// it's only written if it hasn't been since it last changed.
+func (h *PlayHistory) write(onlyPending bool) error {
+	if h.path == "" {
+		return nil
+	}
+
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	h.mu.Lock()
+	if onlyPending && !h.pending {
+		h.mu.Unlock()
+		return nil
+	}
+	h.pending = false
+	data, err := json.Marshal(h.played)
+	h.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("could not encode play history: %v", err)
+	}
+	return util.WriteFileAtomic(h.path, data, 0o644)
+}
+
+// writeLater writes the history in the background, so that play never waits
+// on the disk. Changes made before an earlier write takes its copy of the
+// history are written together.
+// Callers must obtain a mutex before calling.
+func (h *PlayHistory) writeLater() {
+	if h.path == "" || h.pending {
+		return
+	}
+	h.pending = true
+	go func() {
+		if err := h.write(true); err != nil {
+			log.Printf("Failed to save play history: %v", err)
+		}
+	}()
+}
+
+// MarkPlayed records that the question with the given ID has been played.
+func (h *PlayHistory) MarkPlayed(id string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.played[id]; ok {
+		return
+	}
+	h.played[id] = time.Now()
+	h.writeLater()
+}
+
+// Played returns whether the question with the given ID has been played.
+func (h *PlayHistory) Played(id string) bool {
+	if h == nil {
+		return false
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.played[id]
+	return ok
+}
+
+// Len returns the number of questions that have been played.
+func (h *PlayHistory) Len() int {
+	if h == nil {
+		return 0
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.played)
+}
+
+// Reset forgets every question that has been played.
+func (h *PlayHistory) Reset() error {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	h.played = make(map[string]time.Time)
+	h.mu.Unlock()
+	return h.Flush()
+}
+
+func (m *MetaGameDriver) onResetHistoryReset(name string, host bool, _ message.ClientMessage) error {
+	if !host {
+		return nil
+	}
+
+	m.mu.RLock()
+	inControl := m.inControl(name)
+	m.mu.RUnlock()
+	if !inControl {
+		return nil
+	}
+
+	history := m.generator.History()
+	forgotten := history.Len()
+	if err := history.Reset(); err != nil {
+		log.Printf("Failed to save play history after reset: %v", err)
+	}
+	log.Printf("Host %v reset the play history, forgetting %v questions", name, forgotten)
+
+	m.room.MessagePlayer(server.EncodeServerMessage(&message.HistoryReset{Forgotten: forgotten}), name)
+	return nil
+}
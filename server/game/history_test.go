@@ -0,0 +1,49 @@
+package game
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPlayHistoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+
+	h, err := LoadPlayHistory(path)
+	if err != nil {
+		t.Fatalf("LoadPlayHistory() of a missing file failed: %v", err)
+	}
+	h.MarkPlayed("a")
+	h.MarkPlayed("b")
+	h.MarkPlayed("a")
+	if err := h.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+
+	loaded, err := LoadPlayHistory(path)
+	if err != nil {
+		t.Fatalf("LoadPlayHistory() failed: %v", err)
+	}
+	if !loaded.Played("a") || !loaded.Played("b") || loaded.Played("c") {
+		t.Errorf("loaded history doesn't match what was played")
+	}
+	if got := loaded.Len(); got != 2 {
+		t.Errorf("Len() = %v, want 2", got)
+	}
+
+	if err := loaded.Reset(); err != nil {
+		t.Fatalf("Reset() failed: %v", err)
+	}
+	reset, err := LoadPlayHistory(path)
+	if err != nil {
+		t.Fatalf("LoadPlayHistory() after reset failed: %v", err)
+	}
+	if reset.Played("a") || reset.Len() != 0 {
+		t.Errorf("history still has questions after Reset()")
+	}
+
+	var nilHistory *PlayHistory
+	nilHistory.MarkPlayed("a")
+	if nilHistory.Played("a") {
+		t.Errorf("nil history recorded a question")
+	}
+}
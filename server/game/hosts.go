@@ -0,0 +1,87 @@
+package game
+
+import (
+	"log"
+	"sort"
+
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/server"
+)
+
+// generateUpdateHosts creates the UpdateHosts message from the hosts that the
+// game knows about.
+// Callers must obtain a mutex before calling.
+func (m *MetaGameDriver) generateUpdateHosts() *message.UpdateHosts {
+	update := &message.UpdateHosts{}
+	if m.host != nil {
+		update.Host = m.host.Name
+	}
+	for name, stats := range m.coHosts {
+		update.CoHosts = append(update.CoHosts, message.Player{
+			Name:      name,
+			Connected: stats.Connected,
+		})
+	}
+	sort.Slice(update.CoHosts, func(i, j int) bool { return update.CoHosts[i].Name < update.CoHosts[j].Name })
+	return update
+}
+
+// sendUpdateHosts sends an UpdateHosts message to all clients.
+// Callers must obtain a mutex before calling.
+func (m *MetaGameDriver) sendUpdateHosts() {
+	m.room.MessageAll(server.EncodeServerMessage(m.generateUpdateHosts()))
+}
+
+// inControl returns whether name is the host in control of the game, and
+// tells them why not if they're a co-host. Starting games and managing hosts
+// and history are left to the host in control, while running play (selecting,
+// reading and marking) is shared with co-hosts, whose conflicting marks are
+// caught by their attempt numbers.
+// Callers must obtain a mutex before calling.
+func (m *MetaGameDriver) inControl(name string) bool {
+	if m.host != nil && m.host.Name == name {
+		return true
+	}
+	e := server.EncodeServerMessage(&message.ServerError{Error: "Only the host in control of the game can do that", Code: 2013})
+	m.room.MessagePlayer(e, name)
+	return false
+}
+
+func (m *MetaGameDriver) onTransferHostTransfer(name string, host bool, msg message.ClientMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !host {
+		return nil
+	}
+
+	target := msg.Data.(*message.TransferHost).Name
+	// A co-host can take control if the host in control has gone, so that the
+	// game doesn't stall.
+	takeover := target == name && m.host != nil && !m.host.Connected
+	if !takeover && !m.inControl(name) {
+		return nil
+	}
+
+	next, ok := m.coHosts[target]
+	if !ok || !next.Connected {
+		e := server.EncodeServerMessage(&message.ServerError{Error: "Control can only be handed to a connected co-host", Code: 2014})
+		m.room.MessagePlayer(e, name)
+		return nil
+	}
+
+	delete(m.coHosts, target)
+	if m.host != nil {
+		m.coHosts[m.host.Name] = m.host
+	}
+	m.host = next
+	log.Printf("Host %v handed control of room %v to %v", name, m.room.Code(), target)
+
+	m.room.MessageAll(server.EncodeServerMessage(&message.HostAdd{Name: target}))
+	m.sendUpdateHosts()
+
+	if m.gameDriver != nil {
+		m.gameDriver.requestSave()
+	}
+	return nil
+}
@@ -2,13 +2,9 @@ package game
 
 import (
 	"log"
-	"math/rand"
 	"sync"
-	"time"
 
-	"github.com/baconstrip/kiken/common"
 	"github.com/baconstrip/kiken/message"
-	"github.com/baconstrip/kiken/question"
 	"github.com/baconstrip/kiken/server"
 )
 
@@ -20,33 +16,38 @@ type MetaGameDriver struct {
 
 	config Configuration
 
-	server *server.Server
+	room *server.Room
 
 	gameDriver *GameDriver
 
-	questions []*question.Question
+	generator *BoardGenerator
+	shows     ShowSource
+	// show is the game loaded from the show selected by the host, or nil to
+	// play a game made from the question pool.
+	show *Game
 
 	players    map[string]*PlayerStats
 	spectators map[string]*PlayerStats
-	host       *PlayerStats
+	// host is the host in control of the game. Any other hosts who join are
+	// coHosts.
+	host    *PlayerStats
+	coHosts map[string]*PlayerStats
 }
 
-func NewMetaGameDriver(questions []*question.Question, s *server.Server, startingPhase string, gameLm *server.ListenerManager, globalLm *server.ListenerManager) *MetaGameDriver {
-	config := Configuration{
-		ChanceTime:         7 * time.Second,
-		DisambiguationTime: 200 * time.Millisecond,
-		AnswerTime:         10 * time.Second,
-		StartingPhase:      startingPhase,
-	}
-
+// NewMetaGameDriver creates the driver that manages players and games played
+// in the given room. Games are made by generator, unless the host chooses a show
+// from shows, which may be nil.
+func NewMetaGameDriver(generator *BoardGenerator, shows ShowSource, r *server.Room, config Configuration) *MetaGameDriver {
 	return &MetaGameDriver{
-		gameLm:     gameLm,
-		globalLm:   globalLm,
+		shows:      shows,
+		gameLm:     r.GameListeners(),
+		globalLm:   r.GlobalListeners(),
 		config:     config,
-		server:     s,
-		questions:  questions,
+		room:       r,
+		generator:  generator,
 		players:    make(map[string]*PlayerStats),
 		spectators: make(map[string]*PlayerStats),
+		coHosts:    make(map[string]*PlayerStats),
 
 		mu: &sync.RWMutex{},
 	}
@@ -55,6 +56,13 @@ func NewMetaGameDriver(questions []*question.Question, s *server.Server, startin
 func (m *MetaGameDriver) Start() {
 	m.globalLm.RegisterMessage("CancelGame", m.onCancelGameCancel)
 	m.globalLm.RegisterMessage("StartGame", m.onStartGameStart)
+	m.globalLm.RegisterMessage("RequestShows", m.onRequestShowsListShows)
+	m.globalLm.RegisterMessage("SelectShow", m.onSelectShowChooseShow)
+	m.globalLm.RegisterMessage("ResetHistory", m.onResetHistoryReset)
+	m.globalLm.RegisterMessage("RevokeSession", m.onRevokeSessionRevoke)
+	m.globalLm.RegisterMessage("TransferHost", m.onTransferHostTransfer)
+	m.globalLm.RegisterMessage("KickPlayer", m.onKickPlayerKick)
+	m.globalLm.RegisterMessage("BanPlayer", m.onBanPlayerBan)
 	m.globalLm.RegisterJoin(m.onJoinSendUpdatePlayersAndAddPlayer)
 	m.globalLm.RegisterLeave(m.onLeaveMarkDisconnected)
 }
@@ -81,7 +89,7 @@ func (m *MetaGameDriver) generateUpdatePlayers() *message.UpdatePlayers {
 // Callers must obtain a mutex before calling.
 func (m *MetaGameDriver) sendUpdatePlayers() {
 	msg := server.EncodeServerMessage(m.generateUpdatePlayers())
-	m.server.MessageAll(msg)
+	m.room.MessageAll(msg)
 }
 
 // ----- Metagame listeners -----
@@ -94,8 +102,10 @@ func (m *MetaGameDriver) onJoinSendUpdatePlayersAndAddPlayer(name string, host b
 	if _, ok := m.players[name]; ok {
 		m.players[name].Connected = true
 		m.sendUpdatePlayers()
-		msg := server.EncodeServerMessage(&message.HostAdd{Name: m.host.Name})
-		m.server.MessagePlayer(msg, name)
+		if m.host != nil {
+			msg := server.EncodeServerMessage(&message.HostAdd{Name: m.host.Name})
+			m.room.MessagePlayer(msg, name)
+		}
 		return nil
 	}
 
@@ -103,7 +113,21 @@ func (m *MetaGameDriver) onJoinSendUpdatePlayersAndAddPlayer(name string, host b
 		m.host.Connected = true
 		m.sendUpdatePlayers()
 		msg := server.EncodeServerMessage(&message.HostAdd{Name: name})
-		m.server.MessageAll(msg)
+		m.room.MessageAll(msg)
+		m.sendUpdateHosts()
+		return nil
+	}
+
+	// Hosts who join after the first are co-hosts.
+	if host && m.host != nil {
+		if _, ok := m.coHosts[name]; !ok {
+			m.coHosts[name] = &PlayerStats{Name: name}
+		}
+		m.coHosts[name].Connected = true
+		m.sendUpdatePlayers()
+		msg := server.EncodeServerMessage(&message.HostAdd{Name: m.host.Name})
+		m.room.MessagePlayer(msg, name)
+		m.sendUpdateHosts()
 		return nil
 	}
 
@@ -111,7 +135,8 @@ func (m *MetaGameDriver) onJoinSendUpdatePlayersAndAddPlayer(name string, host b
 		m.host = &PlayerStats{Money: 0, Name: name, Connected: true}
 		m.sendUpdatePlayers()
 		msg := server.EncodeServerMessage(&message.HostAdd{Name: name})
-		m.server.MessageAll(msg)
+		m.room.MessageAll(msg)
+		m.sendUpdateHosts()
 		return nil
 	}
 
@@ -130,7 +155,7 @@ func (m *MetaGameDriver) onJoinSendUpdatePlayersAndAddPlayer(name string, host b
 
 	if m.host != nil {
 		msg := server.EncodeServerMessage(&message.HostAdd{Name: m.host.Name})
-		m.server.MessagePlayer(msg, name)
+		m.room.MessagePlayer(msg, name)
 	}
 
 	m.sendUpdatePlayers()
@@ -143,7 +168,12 @@ func (m *MetaGameDriver) onLeaveMarkDisconnected(name string, host bool, spectat
 	defer m.mu.Unlock()
 
 	if host {
-		m.host.Connected = false
+		if m.host != nil && m.host.Name == name {
+			m.host.Connected = false
+		} else if coHost, ok := m.coHosts[name]; ok {
+			coHost.Connected = false
+		}
+		m.sendUpdateHosts()
 		return nil
 	}
 
@@ -164,76 +194,179 @@ func (m *MetaGameDriver) onLeaveMarkDisconnected(name string, host bool, spectat
 	return nil
 }
 
-func (m *MetaGameDriver) onStartGameStart(name string, host bool, _ message.ClientMessage) error {
-	g := makeTestGame(m.questions)
-	driver := NewGameDriver(m.server, g, m.gameLm, m.config, m)
-
-	m.gameDriver = driver
+func (m *MetaGameDriver) onRevokeSessionRevoke(name string, host bool, msg message.ClientMessage) error {
+	if !host {
+		return nil
+	}
 
-	driver.StartGame(name)
+	m.mu.RLock()
+	inControl := m.inControl(name)
+	m.mu.RUnlock()
+	if !inControl {
+		return nil
+	}
 
+	target := msg.Data.(*message.RevokeSession).Name
+	if target == name {
+		e := server.EncodeServerMessage(&message.ServerError{Error: "The host can't revoke their own session", Code: 2010})
+		m.room.MessagePlayer(e, name)
+		return nil
+	}
+	if !m.room.RevokeSession(target) {
+		e := server.EncodeServerMessage(&message.ServerError{Error: "Nobody with that name is in the game", Code: 2011})
+		m.room.MessagePlayer(e, name)
+	}
 	return nil
 }
 
-func (m *MetaGameDriver) onCancelGameCancel(_ string, host bool, _ message.ClientMessage) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
+func (m *MetaGameDriver) onKickPlayerKick(name string, host bool, msg message.ClientMessage) error {
 	if !host {
 		return nil
 	}
 
-	if m.gameDriver != nil {
-		m.gameDriver.EndGame()
+	target := msg.Data.(*message.KickPlayer).Name
+	if m.removePlayer(name, target, m.room.Kick) {
+		log.Printf("Host %v kicked %v", name, target)
 	}
+	return nil
+}
 
-	m.gameDriver = nil
+func (m *MetaGameDriver) onBanPlayerBan(name string, host bool, msg message.ClientMessage) error {
+	if !host {
+		return nil
+	}
 
+	ban := msg.Data.(*message.BanPlayer)
+	kick := func(target string) bool {
+		return m.room.Ban(target, ban.BanAddress)
+	}
+	if m.removePlayer(name, ban.Name, kick) {
+		log.Printf("Host %v banned %v", name, ban.Name)
+	}
 	return nil
 }
 
-// ------------- testing game helper --------------
+// removePlayer disconnects the player, spectator, or co-host named target with
+// kick, and forgets them, so they start over if they rejoin. Errors are sent to
+// the host named host. Returns whether anyone was removed.
+func (m *MetaGameDriver) removePlayer(host, target string, kick func(name string) bool) bool {
+	m.mu.RLock()
+	inControl := m.inControl(host)
+	m.mu.RUnlock()
+	if !inControl {
+		return false
+	}
 
-func makeTestGame(questions []*question.Question) *Game {
-	standardCategories, err := question.CollateFullCategories(questions, true)
-	if err != nil {
-		log.Printf("Failed to create categories from questions: %v", err)
+	if target == host {
+		e := server.EncodeServerMessage(&message.ServerError{Error: "The host can't remove themselves from the game", Code: 2012})
+		m.room.MessagePlayer(e, host)
+		return false
+	}
+	if !kick(target) {
+		e := server.EncodeServerMessage(&message.ServerError{Error: "Nobody with that name is in the game", Code: 2011})
+		m.room.MessagePlayer(e, host)
+		return false
 	}
-	owariCategories := question.CollateLoneQuestions(questions, common.OWARI)
-	tiebreakerCategories := question.CollateLoneQuestions(questions, common.TIEBREAKER)
 
-	log.Printf("Loaded %v standard categories, %v Owari, %v Tiebreaker.", len(standardCategories), len(owariCategories), len(tiebreakerCategories))
+	m.mu.Lock()
+	driver := m.gameDriver
+	if driver != nil {
+		driver.gameState.mu.Lock()
+	}
 
-	// For testing, create a board of the first 4 categories from daiichi/daini,
-	// and a question from owari.
-	daiichiCount, dainiCount := 0, 0
-	var daiichiCats, dainiCats []*question.Category
-	for _, c := range standardCategories {
-		if daiichiCount == 6 {
-			break
-		}
+	// A player who's been removed can't answer, so their attempt ends as
+	// though they'd left.
+	if driver != nil {
+		driver.stopAnswering(target)
+	}
+	wasSelecting := m.players[target] != nil && m.players[target].Selecting
+	delete(m.players, target)
+	delete(m.spectators, target)
+	if _, ok := m.coHosts[target]; ok {
+		delete(m.coHosts, target)
+		m.sendUpdateHosts()
+	}
+	if driver != nil && wasSelecting {
+		driver.makeLowestPlayerSelect()
+	}
+	m.sendUpdatePlayers()
 
-		if c.Round == common.DAIICHI {
-			daiichiCats = append(daiichiCats, c)
-			daiichiCount++
-		}
+	if driver != nil {
+		driver.gameState.mu.Unlock()
 	}
+	m.mu.Unlock()
 
-	for _, c := range standardCategories {
-		if dainiCount == 6 {
-			break
-		}
+	if driver != nil {
+		driver.requestSave()
+	}
+	return true
+}
+
+func (m *MetaGameDriver) onStartGameStart(name string, host bool, _ message.ClientMessage) error {
+	if !host {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.inControl(name) {
+		return nil
+	}
 
-		if c.Round == common.DAINI {
-			dainiCats = append(dainiCats, c)
-			dainiCount++
+	// Only one game is played at a time, and it may have been restored from a
+	// save rather than created here.
+	if m.gameDriver != nil {
+		if m.gameDriver.StartGame(name) {
+			m.gameDriver.requestSave()
 		}
+		return nil
+	}
+
+	if len(m.players) == 0 {
+		e := server.EncodeServerMessage(&message.ServerError{Error: "Please wait for players to join before starting", Code: 2001})
+		m.room.MessagePlayer(e, name)
+		return nil
+	}
+
+	g, err := m.newGame()
+	if err != nil {
+		log.Printf("Failed to make a game: %v", err)
+		e := server.EncodeServerMessage(&message.ServerError{Error: "There aren't enough questions to make a game", Code: 2009})
+		m.room.MessagePlayer(e, name)
+		return nil
+	}
+
+	driver := NewGameDriver(m.room, g, m.gameLm, m.config, m)
+	if !driver.StartGame(name) {
+		driver.listenerManager.ClearListeners()
+		driver.saver.stop()
+		return nil
+	}
+
+	// The game's questions only count as played once it has started.
+	m.gameDriver = driver
+	m.generator.RecordPlayed(g)
+	driver.requestSave()
+
+	return nil
+}
+
+func (m *MetaGameDriver) onCancelGameCancel(name string, host bool, _ message.ClientMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !host || !m.inControl(name) {
+		return nil
 	}
 
-	daiichiBoard := NewBoard(common.DAIICHI, daiichiCats...)
-	dainiBoard := NewBoard(common.DAINI, dainiCats...)
-	owariBoard := NewBoard(common.OWARI, owariCategories[rand.Intn(len(owariCategories))])
+	if m.gameDriver != nil {
+		m.gameDriver.EndGame()
+	}
 
-	g := New(daiichiBoard, dainiBoard, owariBoard)
-	return g
+	m.gameDriver = nil
+	// Bans only last for the game they were made in.
+	m.room.ClearBans()
+
+	return nil
 }
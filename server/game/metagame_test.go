@@ -0,0 +1,62 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/server"
+)
+
+func TestStartGameRecordsOnlyStartedGames(t *testing.T) {
+	r, err := server.New("", server.Credentials{}, 0, nil).CreateRoom("test")
+	if err != nil {
+		t.Fatalf("CreateRoom() failed: %v", err)
+	}
+	gen := NewBoardGenerator(testPool(1, 20), GeneratorOptions{Seed: 1, AvoidRecent: 5}, nil)
+	m := NewMetaGameDriver(gen, nil, r, Configuration{})
+	start := message.ClientMessage{Type: "StartGame", Data: &message.StartGame{}}
+
+	m.host = &PlayerStats{Name: "host", Connected: true}
+	m.coHosts["cohost"] = &PlayerStats{Name: "cohost", Connected: true}
+
+	m.onStartGameStart("player", false, start)
+	m.onStartGameStart("host", true, start)
+	m.players["player"] = &PlayerStats{Name: "player", Connected: true}
+	m.onStartGameStart("cohost", true, start)
+	if m.gameDriver != nil || len(gen.recent) != 0 {
+		t.Fatalf("a game that didn't start was recorded as played")
+	}
+
+	m.onStartGameStart("host", true, start)
+	if m.gameDriver == nil {
+		t.Fatalf("StartGame with a player didn't start a game")
+	}
+	if len(gen.recent) != 1 {
+		t.Errorf("started game was recorded %v times, want once", len(gen.recent))
+	}
+	m.gameDriver.saver.stop()
+}
+
+func TestKickAnsweringPlayer(t *testing.T) {
+	g := newTestGame(t, Configuration{}, "alice", "bob")
+	buzzIn(t, g, "first200", "alice")
+
+	if !g.metagame.removePlayer("host", "alice", func(string) bool { return true }) {
+		t.Fatalf("removePlayer() didn't remove the player answering")
+	}
+	if g.gameState.currentStatus != STATUS_PLAYERS_BUZZING {
+		t.Errorf("status after removing the player answering = %v, want %v", g.gameState.currentStatus, STATUS_PLAYERS_BUZZING)
+	}
+
+	// The removed player's answer can't be marked, but others can still buzz
+	// in and answer.
+	send(t, g.OnMarkAnswerMessageMoveAlong, "host", true, &message.MarkAnswer{Correct: true})
+	send(t, g.OnAttemptAnswerMessageAllowAnswer, "bob", false, &message.AttemptAnswer{ResponseTime: 100})
+	if err := g.TimedSelectPlayerToAnswer(); err != nil {
+		t.Fatalf("TimedSelectPlayerToAnswer() failed: %v", err)
+	}
+	send(t, g.OnMarkAnswerMessageMoveAlong, "host", true, &message.MarkAnswer{Correct: true})
+	if bob := g.metagame.players["bob"]; bob.Money != 200 || !bob.Selecting {
+		t.Errorf("bob after answering correctly = %+v, want 200 and selecting", *bob)
+	}
+}
@@ -0,0 +1,81 @@
+package game
+
+import (
+	"log"
+
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/server"
+)
+
+// pausedInterval returns the time in milliseconds left on the countdown that
+// clients display for the status play will resume at.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) pausedInterval() int {
+	if g.quesState == nil {
+		return 0
+	}
+
+	var t *gameTimer
+	switch g.gameState.effectiveStatus() {
+	case STATUS_PLAYERS_BUZZING:
+		t = g.quesState.buzzTimer
+	case STATUS_PLAYERS_ANSWERING:
+		t = g.quesState.answerTimer
+	}
+	return int(t.Remaining().Milliseconds())
+}
+
+func (g *GameDriver) OnPauseMessagePause(name string, host bool, msg message.ClientMessage) error {
+	g.gameState.mu.Lock()
+	defer g.gameState.mu.Unlock()
+
+	if !host {
+		return nil
+	}
+
+	switch g.gameState.currentStatus {
+	case STATUS_UNKNOWN, STATUS_PREPARING, STATUS_PRESTART, STATUS_PAUSED, STATUS_GAME_OVER:
+		return nil
+	}
+
+	log.Printf("Pausing game during status %v", g.gameState.currentStatus)
+
+	g.gameState.pausedStatus = g.gameState.currentStatus
+	g.gameState.currentStatus = STATUS_PAUSED
+	if g.quesState != nil {
+		for _, t := range g.quesState.timers() {
+			t.Pause()
+		}
+	}
+
+	g.room.MessageAll(server.EncodeServerMessage(&message.GamePaused{Interval: g.pausedInterval()}))
+	return nil
+}
+
+func (g *GameDriver) OnResumeMessageResume(name string, host bool, msg message.ClientMessage) error {
+	g.gameState.mu.Lock()
+	defer g.gameState.mu.Unlock()
+
+	if !host {
+		return nil
+	}
+
+	if g.gameState.currentStatus != STATUS_PAUSED {
+		return nil
+	}
+
+	interval := g.pausedInterval()
+
+	log.Printf("Resuming game at status %v", g.gameState.pausedStatus)
+
+	g.gameState.currentStatus = g.gameState.pausedStatus
+	g.gameState.pausedStatus = STATUS_UNKNOWN
+	if g.quesState != nil {
+		for _, t := range g.quesState.timers() {
+			t.Resume()
+		}
+	}
+
+	g.room.MessageAll(server.EncodeServerMessage(&message.GameResumed{Interval: interval}))
+	return nil
+}
@@ -0,0 +1,326 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/server"
+	"github.com/baconstrip/kiken/util"
+)
+
+// savedGame contains everything needed to restore a game in progress.
+type savedGame struct {
+	Game    *GameStateSnapshot
+	Players map[string]PlayerStats
+	Host    string
+
+	// InFlight is the ID of the question being played when the game was saved,
+	// if any.
+	InFlight string
+
+	OwariBids    map[string]int
+	OwariAnswers map[string]string
+	OwariMarked  map[string]bool
+
+	TiebreakerPlayers []string
+	TiebreakerWinner  string
+
+	// AnswerAttempt is the number of the last attempt to answer, so that
+	// hosts can't mark attempts made before the save as ones made after.
+	AnswerAttempt int
+
+	GameOver *message.GameOver
+
+	// number orders the snapshots taken of the game, and final is set on the
+	// snapshot taken when the server shuts down.
+	number uint64
+	final  bool
+}
+
+// snapshot creates a savedGame from the current state of the game.
+// Callers must obtain both the metagame's and the game's mutex before calling.
+func (g *GameDriver) snapshot() *savedGame {
+	// The snapshot is encoded after the mutexes are released, so it mustn't
+	// share anything the game changes.
+	owari := g.owariState.copy()
+	saved := &savedGame{
+		Game:         g.gameState.Snapshot(),
+		Players:      make(map[string]PlayerStats),
+		OwariBids:    owari.bids,
+		OwariAnswers: owari.answers,
+		OwariMarked:  owari.marked,
+		GameOver:     g.gameOver,
+
+		AnswerAttempt: g.gameState.answerAttempt,
+
+		number: atomic.AddUint64(&g.saver.taken, 1),
+	}
+	for name, ply := range g.metagame.players {
+		saved.Players[name] = *ply
+	}
+	if g.metagame.host != nil {
+		saved.Host = g.metagame.host.Name
+	}
+	if g.quesState != nil {
+		saved.InFlight = g.quesState.question.Data.ID
+	}
+	if g.tiebreaker != nil {
+		saved.TiebreakerPlayers = append([]string(nil), g.tiebreaker.players...)
+		saved.TiebreakerWinner = g.tiebreaker.winner
+	}
+	return saved
+}
+
+// saver writes a game to its SavePath in the background, so that play never
+// waits on the disk.
+type saver struct {
+	// requests is signalled when the game has changed. Changes made while a
+	// save is being written are saved together once it's done.
+	requests chan struct{}
+	// stopped is closed once the game no longer needs saving.
+	stopped  chan struct{}
+	stopOnce sync.Once
+
+	// mu is held while writing, so that saves are written one at a time.
+	mu sync.Mutex
+	// taken counts the snapshots taken, and written is the number of the
+	// newest snapshot written, so that an older snapshot never replaces a
+	// newer one.
+	taken   uint64
+	written uint64
+}
+
+func newSaver() *saver {
+	return &saver{
+		requests: make(chan struct{}, 1),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// stop stops saving the game. Saves already being written are discarded.
+func (s *saver) stop() {
+	s.stopOnce.Do(func() { close(s.stopped) })
+}
+
+// isStopped returns whether the game no longer needs saving.
+func (s *saver) isStopped() bool {
+	select {
+	case <-s.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// requestSave asks for the game to be saved in the background.
+func (g *GameDriver) requestSave() {
+	if g.config.SavePath == "" {
+		return
+	}
+	select {
+	case g.saver.requests <- struct{}{}:
+	default:
+		// A save is already waiting, and it will include this change.
+	}
+}
+
+// saveInBackground saves the game whenever it's requested, until the saver is
+// stopped.
+func (g *GameDriver) saveInBackground() {
+	for {
+		select {
+		case <-g.saver.stopped:
+			return
+		case <-g.saver.requests:
+			g.save()
+		}
+	}
+}
+
+// save takes a snapshot of the game and writes it. The metagame's mutex and the
+// game's mutex are both held while taking the snapshot, in that order, since
+// the players belong to the metagame but scores are changed by the game.
+func (g *GameDriver) save() {
+	g.metagame.mu.RLock()
+	g.gameState.mu.RLock()
+	saved := g.snapshot()
+	g.gameState.mu.RUnlock()
+	g.metagame.mu.RUnlock()
+
+	g.writeSave(saved)
+}
+
+// writeSave writes a snapshot of the game to the configured SavePath, unless a
+// newer snapshot has already been written or the saver has been stopped.
+func (g *GameDriver) writeSave(saved *savedGame) {
+	if g.config.SavePath == "" {
+		return
+	}
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		log.Printf("Failed to encode game for saving: %v", err)
+		return
+	}
+
+	g.saver.mu.Lock()
+	defer g.saver.mu.Unlock()
+	if saved.number <= g.saver.written || g.saver.isStopped() && !saved.final {
+		return
+	}
+	if err := util.WriteFileAtomic(g.config.SavePath, data, 0o644); err != nil {
+		log.Printf("Failed to save game: %v", err)
+		return
+	}
+	g.saver.written = saved.number
+}
+
+// discardSave stops saving the game, and removes the saved copy of it, once
+// it's no longer needed.
+func (g *GameDriver) discardSave() {
+	g.saver.stop()
+	if g.config.SavePath == "" {
+		return
+	}
+	// Wait for a save being written, so that it can't recreate the file.
+	g.saver.mu.Lock()
+	defer g.saver.mu.Unlock()
+	if err := os.Remove(g.config.SavePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove saved game: %v", err)
+	}
+}
+
+// persisted wraps a listener so that the game is saved after it runs.
+func (g *GameDriver) persisted(l server.ClientMessageListener) server.ClientMessageListener {
+	return func(name string, host bool, msg message.ClientMessage) error {
+		err := l(name, host, msg)
+		g.requestSave()
+		return err
+	}
+}
+
+// persistedLeave wraps a listener so that the game is saved after it runs.
+func (g *GameDriver) persistedLeave(l server.LeaveListener) server.LeaveListener {
+	return func(name string, host bool, spectator bool) error {
+		err := l(name, host, spectator)
+		g.requestSave()
+		return err
+	}
+}
+
+// persistedTimed wraps a timed function so that the game is saved after it
+// runs.
+func (g *GameDriver) persistedTimed(f timedFunc) timedFunc {
+	return func() error {
+		err := f()
+		g.requestSave()
+		return err
+	}
+}
+
+// restoreGameDriver creates a GameDriver from a saved game. A question that was
+// in progress can't be resumed, since buzzes and timers aren't saved, so play
+// returns to the board with that question available again.
+func restoreGameDriver(r *server.Room, saved *savedGame, lm *server.ListenerManager, config Configuration, metagame *MetaGameDriver) *GameDriver {
+	gs := saved.Game.restore()
+	driver := newGameDriver(r, gs, lm, config, metagame)
+
+	if saved.OwariBids != nil {
+		driver.owariState.bids = saved.OwariBids
+	}
+	if saved.OwariAnswers != nil {
+		driver.owariState.answers = saved.OwariAnswers
+	}
+	if saved.OwariMarked != nil {
+		driver.owariState.marked = saved.OwariMarked
+	}
+	if saved.TiebreakerPlayers != nil {
+		driver.tiebreaker = &tiebreakerState{
+			players: saved.TiebreakerPlayers,
+			winner:  saved.TiebreakerWinner,
+		}
+	}
+	driver.gameOver = saved.GameOver
+	gs.answerAttempt = saved.AnswerAttempt
+
+	if gs.currentStatus == STATUS_PAUSED {
+		gs.currentStatus = gs.pausedStatus
+		gs.pausedStatus = STATUS_UNKNOWN
+	}
+
+	switch gs.currentStatus {
+	case STATUS_PRESENTING_QUESTION, STATUS_PLAYERS_BUZZING, STATUS_PLAYERS_ANSWERING, STATUS_ACCEPTING_PACHI_BID, STATUS_POST_QUESTION:
+		if driver.inTiebreaker() {
+			gs.currentStatus = STATUS_TIEBREAKER
+			break
+		}
+		if gs.currentStatus != STATUS_POST_QUESTION {
+			if q := gs.FindQuestion(saved.InFlight); q != nil {
+				q.Played = false
+			}
+		}
+		gs.currentStatus = STATUS_SHOWING_BOARD
+	}
+
+	return driver
+}
+
+// Shutdown stops play in the game in progress, if any, and saves it so that it
+// can be restored when the server starts again.
+func (m *MetaGameDriver) Shutdown() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.gameDriver == nil {
+		return
+	}
+
+	driver := m.gameDriver
+	driver.saver.stop()
+	driver.gameState.mu.Lock()
+	driver.stopTimers()
+	saved := driver.snapshot()
+	driver.gameState.mu.Unlock()
+
+	saved.final = true
+	driver.writeSave(saved)
+	log.Printf("Saved game in room %v for shutdown", m.room.Code())
+}
+
+// Restore reloads the game that was in progress when it was last saved to the
+// configured SavePath. Players are marked as disconnected until they rejoin.
+func (m *MetaGameDriver) Restore() error {
+	data, err := os.ReadFile(m.config.SavePath)
+	if err != nil {
+		return fmt.Errorf("could not read saved game: %w", err)
+	}
+
+	var saved savedGame
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("could not decode saved game: %v", err)
+	}
+	if saved.Game == nil {
+		return fmt.Errorf("saved game contains no game state")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, stats := range saved.Players {
+		ply := stats
+		ply.Connected = false
+		m.players[name] = &ply
+	}
+	if saved.Host != "" {
+		m.host = &PlayerStats{Name: saved.Host}
+	}
+
+	m.gameDriver = restoreGameDriver(m.room, &saved, m.gameLm, m.config, m)
+	log.Printf("Restored saved game in round %v with %v players", m.gameDriver.gameState.currentRound, len(m.players))
+	return nil
+}
@@ -0,0 +1,129 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/baconstrip/kiken/common"
+	"github.com/baconstrip/kiken/message"
+	"github.com/kr/pretty"
+)
+
+func TestGameStateSnapshotRoundTrip(t *testing.T) {
+	daiichi := NewBoard(common.DAIICHI,
+		testCategory("first", common.DAIICHI, 200, 400, 600, 800, 1000),
+		testCategory("second", common.DAIICHI, 200, 400, 600, 800, 1000))
+	daiichi.PickPachi(rand.New(rand.NewSource(1)), 1)
+	daini := NewBoard(common.DAINI, testCategory("third", common.DAINI, 400, 800, 1200, 1600, 2000))
+	owari := NewBoard(common.OWARI, testCategory("last", common.OWARI, 0))
+
+	gs := New(daiichi, daini, owari).CreateState()
+	gs.currentRound = common.DAIICHI
+	gs.currentStatus = STATUS_PAUSED
+	gs.pausedStatus = STATUS_SHOWING_BOARD
+	gs.Boards[0].Categories[1].Questions[3].Played = true
+	gs.Boards[0].Categories[0].Questions[0].Played = true
+
+	want := gs.Snapshot()
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("Failed to encode snapshot: %v", err)
+	}
+	var decoded GameStateSnapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode snapshot: %v", err)
+	}
+
+	restored := decoded.restore()
+	got := restored.Snapshot()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Restored snapshot differs, got:\n\n %v\n\nwant: %v\n\n", pretty.Sprint(got), pretty.Sprint(want))
+	}
+
+	pachi := daiichi.pachi[0].ID
+	if !restored.Boards[0].data.IsPachi(pachi) {
+		t.Errorf("Restored board lost pachi question %v", pachi)
+	}
+}
+
+func TestWriteSaveKeepsNewest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.json")
+	g := &GameDriver{config: Configuration{SavePath: path}, saver: newSaver()}
+
+	older := &savedGame{Host: "older", number: 1}
+	newer := &savedGame{Host: "newer", number: 2}
+	g.writeSave(newer)
+	g.writeSave(older)
+	if got := readSave(t, path).Host; got != "newer" {
+		t.Errorf("saved game is from the %v snapshot, want the newer one", got)
+	}
+
+	g.discardSave()
+	g.writeSave(&savedGame{Host: "late", number: 3})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("a save written after the game was discarded recreated it")
+	}
+	g.writeSave(&savedGame{Host: "shutdown", number: 4, final: true})
+	if got := readSave(t, path).Host; got != "shutdown" {
+		t.Errorf("saved game is from the %v snapshot, want the one taken at shutdown", got)
+	}
+}
+
+// TestSaveDuringOwari checks that saving doesn't race with Owari bids and
+// answers being entered. Run it with -race.
+func TestSaveDuringOwari(t *testing.T) {
+	var players []string
+	for i := 0; i < 200; i++ {
+		players = append(players, fmt.Sprintf("player%v", i))
+	}
+	g := newTestGame(t, Configuration{StartingPhase: "owari", SavePath: filepath.Join(t.TempDir(), "game.json")}, players...)
+
+	done := make(chan struct{})
+	started := make(chan struct{})
+	saved := make(chan struct{})
+	go func() {
+		defer close(saved)
+		close(started)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				g.save()
+			}
+		}
+	}()
+	<-started
+	for _, name := range players {
+		send(t, g.OnEnterBidAddBid, name, false, &message.EnterBid{Money: 500})
+	}
+	for _, name := range players {
+		send(t, g.OnFreeformAnswerAddAnswerOwari, name, false, &message.FreeformAnswer{Message: "answer"})
+	}
+	close(done)
+	<-saved
+
+	g.save()
+	got := readSave(t, g.config.SavePath)
+	if len(got.OwariBids) != len(players) || len(got.OwariAnswers) != len(players) {
+		t.Errorf("saved %v bids and %v answers, want %v of each", len(got.OwariBids), len(got.OwariAnswers), len(players))
+	}
+}
+
+func readSave(t *testing.T, path string) *savedGame {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read saved game: %v", err)
+	}
+	var saved savedGame
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("Failed to decode saved game: %v", err)
+	}
+	return &saved
+}
@@ -0,0 +1,91 @@
+package game
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/server"
+)
+
+// leaders returns the names of the players with the most money, sorted by
+// name. Disconnected players are included, since they keep their money and
+// can rejoin to play the tiebreaker.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) leaders() []string {
+	top := math.MinInt32
+	var names []string
+	for name, ply := range g.metagame.players {
+		if ply.Money > top {
+			top = ply.Money
+			names = nil
+		}
+		if ply.Money == top {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// concludeGame finishes the game once Owari has been resolved, moving on to a
+// tiebreaker if more than one player is tied for first place.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) concludeGame() {
+	leaders := g.leaders()
+	if len(leaders) > 1 {
+		g.beginTiebreaker(leaders)
+		return
+	}
+
+	winner := ""
+	if len(leaders) == 1 {
+		winner = leaders[0]
+	}
+	g.finishGame(winner)
+}
+
+// finishGame ends the game and sends the final standings to all clients.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) finishGame(winner string) {
+	log.Printf("Game over, winner: %q", winner)
+
+	g.gameState.currentStatus = STATUS_GAME_OVER
+	g.gameOver = &message.GameOver{
+		Winner:    winner,
+		Standings: standings(g.metagame.players, winner),
+	}
+	g.room.MessageAll(server.EncodeServerMessage(g.gameOver))
+}
+
+// standings ranks players by their money. Players with equal money share a
+// rank, except for the winner, who is always ranked first on their own.
+func standings(players map[string]*PlayerStats, winner string) []*message.Standing {
+	var result []*message.Standing
+	for name, ply := range players {
+		result = append(result, &message.Standing{Name: name, Money: ply.Money})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Money != result[j].Money {
+			return result[i].Money > result[j].Money
+		}
+		if result[i].Name == winner || result[j].Name == winner {
+			return result[i].Name == winner
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	for i, s := range result {
+		s.Rank = i + 1
+		if i == 0 {
+			continue
+		}
+		prev := result[i-1]
+		if prev.Money == s.Money && prev.Name != winner {
+			s.Rank = prev.Rank
+		}
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/baconstrip/kiken/message"
+	"github.com/kr/pretty"
+)
+
+func TestStandings(t *testing.T) {
+	tests := []struct {
+		name    string
+		players map[string]int
+		winner  string
+		want    []*message.Standing
+	}{
+		{
+			name:    "Orders by money",
+			players: map[string]int{"a": 100, "b": 300, "c": 200},
+			winner:  "b",
+			want: []*message.Standing{
+				{Name: "b", Money: 300, Rank: 1},
+				{Name: "c", Money: 200, Rank: 2},
+				{Name: "a", Money: 100, Rank: 3},
+			},
+		},
+		{
+			name:    "Equal money shares a rank",
+			players: map[string]int{"a": 100, "b": 300, "c": 100},
+			winner:  "b",
+			want: []*message.Standing{
+				{Name: "b", Money: 300, Rank: 1},
+				{Name: "a", Money: 100, Rank: 2},
+				{Name: "c", Money: 100, Rank: 2},
+			},
+		},
+		{
+			name:    "Tiebreaker winner ranks first alone",
+			players: map[string]int{"a": 500, "b": 500, "c": 500, "d": -200},
+			winner:  "c",
+			want: []*message.Standing{
+				{Name: "c", Money: 500, Rank: 1},
+				{Name: "a", Money: 500, Rank: 2},
+				{Name: "b", Money: 500, Rank: 2},
+				{Name: "d", Money: -200, Rank: 4},
+			},
+		},
+		{
+			name:    "Unresolved tie",
+			players: map[string]int{"a": 500, "b": 500},
+			winner:  "",
+			want: []*message.Standing{
+				{Name: "a", Money: 500, Rank: 1},
+				{Name: "b", Money: 500, Rank: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			players := make(map[string]*PlayerStats)
+			for name, money := range test.players {
+				players[name] = &PlayerStats{Name: name, Money: money}
+			}
+			got := standings(players, test.winner)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("standings() produced unexpected output, got:\n\n %v\n\nwant: %v\n\n", pretty.Sprint(got), pretty.Sprint(test.want))
+			}
+		})
+	}
+}
+
+func TestLeaders(t *testing.T) {
+	tests := []struct {
+		name         string
+		players      map[string]int
+		disconnected []string
+		want         []string
+	}{
+		{
+			name:    "One leader",
+			players: map[string]int{"a": 100, "b": 300, "c": 200},
+			want:    []string{"b"},
+		},
+		{
+			name:    "Tied leaders sorted by name",
+			players: map[string]int{"c": 300, "a": 300, "b": 200},
+			want:    []string{"a", "c"},
+		},
+		{
+			name:    "Everyone negative",
+			players: map[string]int{"a": -400, "b": -200},
+			want:    []string{"b"},
+		},
+		{
+			name:         "Disconnected players can tie",
+			players:      map[string]int{"a": 500, "b": 500, "c": 100},
+			disconnected: []string{"b"},
+			want:         []string{"a", "b"},
+		},
+		{
+			name: "No players",
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			players := make(map[string]*PlayerStats)
+			for name, money := range test.players {
+				players[name] = &PlayerStats{Name: name, Money: money, Connected: true}
+			}
+			for _, name := range test.disconnected {
+				players[name].Connected = false
+			}
+			g := &GameDriver{metagame: &MetaGameDriver{players: players}}
+			if got := g.leaders(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("leaders() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
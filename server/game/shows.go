@@ -0,0 +1,118 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+
+	"github.com/baconstrip/kiken/common"
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/server"
+)
+
+// RandomShowID is the show ID the host selects to play a game made from the
+// question pool rather than a saved show.
+const RandomShowID = "random"
+
+const randomShowName = "Random from question pool"
+
+// ShowSource provides the saved shows that a host can choose to play.
+type ShowSource interface {
+	// ListShows returns the names of the available shows, keyed by ID.
+	ListShows() (map[string]string, error)
+	// LoadShow returns the game described by the show with the given ID.
+	LoadShow(id string) (*Game, error)
+}
+
+// pickPachi designates the pachi questions on each board of g.
+func pickPachi(g *Game, r *rand.Rand) {
+	for _, b := range g.Boards {
+		switch b.Round {
+		case common.DAIICHI:
+			b.PickPachi(r, 1)
+		case common.DAINI:
+			b.PickPachi(r, 2)
+		}
+	}
+}
+
+// newGame creates the game for the selected show, or generates one from the
+// question pool if no show has been selected.
+// Callers must obtain a mutex before calling.
+func (m *MetaGameDriver) newGame() (*Game, error) {
+	if m.show == nil {
+		return m.generator.Generate()
+	}
+	return m.generator.CompleteShow(m.show), nil
+}
+
+// loadShow loads the show with the given ID, returning its game and name.
+func (m *MetaGameDriver) loadShow(id string) (*Game, string, error) {
+	if m.shows == nil {
+		return nil, "", fmt.Errorf("no shows are available")
+	}
+	shows, err := m.shows.ListShows()
+	if err != nil {
+		return nil, "", err
+	}
+	name, ok := shows[id]
+	if !ok {
+		return nil, "", fmt.Errorf("no show with ID %v", id)
+	}
+	g, err := m.shows.LoadShow(id)
+	return g, name, err
+}
+
+func (m *MetaGameDriver) onRequestShowsListShows(name string, host bool, _ message.ClientMessage) error {
+	if !host {
+		return nil
+	}
+
+	shows := map[string]string{}
+	if m.shows != nil {
+		var err error
+		if shows, err = m.shows.ListShows(); err != nil {
+			log.Printf("Failed to list shows for host: %v", err)
+			shows = map[string]string{}
+		}
+	}
+	shows[RandomShowID] = randomShowName
+
+	m.room.MessagePlayer(server.EncodeServerMessage(&message.AvailableShows{Shows: shows}), name)
+	return nil
+}
+
+func (m *MetaGameDriver) onSelectShowChooseShow(name string, host bool, msg message.ClientMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !host || !m.inControl(name) {
+		return nil
+	}
+
+	if m.gameDriver != nil {
+		e := server.EncodeServerMessage(&message.ServerError{Error: "Cancel the game in progress before choosing another show", Code: 2007})
+		m.room.MessagePlayer(e, name)
+		return nil
+	}
+
+	id := msg.Data.(*message.SelectShow).ShowID
+	if id == "" || id == RandomShowID {
+		m.show = nil
+		m.room.MessageAll(server.EncodeServerMessage(&message.ShowSelected{ID: RandomShowID, Name: randomShowName}))
+		return nil
+	}
+
+	g, showName, err := m.loadShow(id)
+	if err != nil {
+		log.Printf("Failed to load show %v: %v", id, err)
+		e := server.EncodeServerMessage(&message.ServerError{Error: "Could not load that show", Code: 2008})
+		m.room.MessagePlayer(e, name)
+		return nil
+	}
+
+	m.show = g
+	log.Printf("Host selected show %v", showName)
+	m.room.MessageAll(server.EncodeServerMessage(&message.ShowSelected{ID: id, Name: showName}))
+	return nil
+}
@@ -0,0 +1,110 @@
+package game
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/baconstrip/kiken/common"
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/question"
+	"github.com/baconstrip/kiken/server"
+)
+
+type fakeShowSource map[string]*Game
+
+func (f fakeShowSource) ListShows() (map[string]string, error) {
+	shows := make(map[string]string)
+	for id := range f {
+		shows[id] = "show " + id
+	}
+	return shows, nil
+}
+
+func (f fakeShowSource) LoadShow(id string) (*Game, error) {
+	g, ok := f[id]
+	if !ok {
+		return nil, fmt.Errorf("no show %v", id)
+	}
+	return g, nil
+}
+
+func TestNewGameFromShow(t *testing.T) {
+	show := New(
+		NewBoard(common.DAIICHI, testCategory("a", common.DAIICHI, 200, 400)),
+		NewBoard(common.DAINI, testCategory("b", common.DAINI, 400, 800), testCategory("c", common.DAINI, 400, 800)),
+		NewBoard(common.OWARI, testCategory("o", common.OWARI, 0)),
+	)
+	pool := []*question.Question{{Category: "tb", Round: common.TIEBREAKER, ID: "tb"}}
+
+	m := &MetaGameDriver{
+		generator: NewBoardGenerator(pool, GeneratorOptions{Seed: 1}, nil),
+		shows:     fakeShowSource{"s1": show},
+	}
+
+	if _, _, err := m.loadShow("missing"); err == nil {
+		t.Errorf("loadShow() of an unknown show succeeded")
+	}
+	g, name, err := m.loadShow("s1")
+	if err != nil {
+		t.Fatalf("loadShow() failed: %v", err)
+	}
+	if name != "show s1" {
+		t.Errorf("loadShow() name = %q, want %q", name, "show s1")
+	}
+
+	m.show = g
+	for i := 0; i < 2; i++ {
+		got, err := m.newGame()
+		if err != nil {
+			t.Fatalf("newGame() failed: %v", err)
+		}
+		if len(got.Boards) != 4 {
+			t.Fatalf("newGame() made %v boards, want 4", len(got.Boards))
+		}
+		if got.Boards[3].Round != common.TIEBREAKER || len(got.Boards[3].Categories) != 1 {
+			t.Errorf("newGame() didn't add the pool's tiebreaker board, got %+v", got.Boards[3])
+		}
+		if len(got.Boards[0].pachi) != 1 || len(got.Boards[1].pachi) != 2 {
+			t.Errorf("newGame() picked %v and %v pachi questions, want 1 and 2", len(got.Boards[0].pachi), len(got.Boards[1].pachi))
+		}
+	}
+	if len(show.Boards) != 3 {
+		t.Errorf("newGame() modified the selected show's boards")
+	}
+	for _, b := range show.Boards {
+		if len(b.pachi) != 0 {
+			t.Errorf("newGame() picked pachi questions on the selected show's %v board", b.Round)
+		}
+	}
+
+	// Games made from the same show don't share boards, so playing one can't
+	// change another.
+	first, _ := m.newGame()
+	second, _ := m.newGame()
+	for i := range show.Boards {
+		if first.Boards[i] == second.Boards[i] || first.Boards[i].Categories[0] == second.Boards[i].Categories[0] {
+			t.Errorf("games made from the same show share their %v board", first.Boards[i].Round)
+		}
+	}
+}
+
+func TestOnlyHostInControlSelectsShow(t *testing.T) {
+	r, err := server.New("", server.Credentials{}, 0, nil).CreateRoom("test")
+	if err != nil {
+		t.Fatalf("CreateRoom() failed: %v", err)
+	}
+	show := New(NewBoard(common.DAIICHI, testCategory("a", common.DAIICHI, 200)))
+	m := NewMetaGameDriver(NewBoardGenerator(nil, GeneratorOptions{}, nil), fakeShowSource{"s1": show}, r, Configuration{})
+	m.host = &PlayerStats{Name: "host", Connected: true}
+	m.coHosts["cohost"] = &PlayerStats{Name: "cohost", Connected: true}
+	sel := message.ClientMessage{Type: "SelectShow", Data: &message.SelectShow{ShowID: "s1"}}
+
+	m.onSelectShowChooseShow("cohost", true, sel)
+	if m.show != nil {
+		t.Errorf("a co-host selected a show")
+	}
+	m.onSelectShowChooseShow("host", true, sel)
+	if m.show != show {
+		t.Errorf("the host in control couldn't select a show")
+	}
+}
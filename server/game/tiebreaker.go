@@ -0,0 +1,141 @@
+package game
+
+import (
+	"log"
+
+	"github.com/baconstrip/kiken/common"
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/question"
+	"github.com/baconstrip/kiken/server"
+)
+
+type tiebreakerState struct {
+	// players contains the names of the players tied for first place, who are
+	// the only players allowed to answer.
+	players []string
+	winner  string
+}
+
+func (t *tiebreakerState) includes(name string) bool {
+	for _, p := range t.players {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tiebreakerState) beginMessage() *message.BeginTiebreaker {
+	return &message.BeginTiebreaker{Players: t.players}
+}
+
+// inTiebreaker returns whether the game has moved on to a tiebreaker.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) inTiebreaker() bool {
+	return g.tiebreaker != nil && g.gameState.currentRound == common.TIEBREAKER
+}
+
+func (g *GameDriver) beginTiebreaker(players []string) {
+	log.Printf("Players tied for first, starting tiebreaker: %v", players)
+
+	g.tiebreaker = &tiebreakerState{players: players}
+	g.gameState.currentRound = common.TIEBREAKER
+	g.gameState.currentStatus = STATUS_TIEBREAKER
+
+	g.room.MessageAll(server.EncodeServerMessage(g.tiebreaker.beginMessage()))
+}
+
+// nextTiebreakerQuestion returns the next tiebreaker question that hasn't been
+// played, or nil if there are none left.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) nextTiebreakerQuestion() *question.QuestionState {
+	b := g.gameState.CurrentBoard()
+	if b == nil {
+		return nil
+	}
+	for _, c := range b.Categories {
+		for _, q := range c.Questions {
+			if !q.Played {
+				return q
+			}
+		}
+	}
+	return nil
+}
+
+// presentTiebreakerQuestion shows a fresh tiebreaker question to the host and
+// the tied players.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) presentTiebreakerQuestion() {
+	g.room.MessageAll(server.EncodeServerMessage(&message.HideQuestion{}))
+
+	q := g.nextTiebreakerQuestion()
+	if q == nil {
+		log.Printf("Ran out of tiebreaker questions, game ends tied")
+		g.declareTiebreakerWinner("")
+		return
+	}
+
+	snap := q.Snapshot()
+	playerPrompt := server.EncodeServerMessage(snap.ToQuestionPrompt(false))
+	for _, name := range g.tiebreaker.players {
+		g.room.MessagePlayer(playerPrompt, name)
+	}
+	g.room.MessageHost(server.EncodeServerMessage(snap.ToQuestionPrompt(true)))
+
+	g.gameState.currentStatus = STATUS_PRESENTING_QUESTION
+	g.quesState = &questionPromptState{
+		attemptedBuzzes: make(map[string]int),
+		question:        q,
+	}
+	g.markPlayed(q)
+}
+
+// markTiebreakerAnswer ends the game if the answer was correct. Otherwise the
+// remaining tied players get a chance to answer, and if none remain the host
+// may move on to another question. Money is unaffected by the tiebreaker.
+// Callers must obtain a mutex before calling.
+func (g *GameDriver) markTiebreakerAnswer(correct bool) {
+	if correct {
+		g.room.MessageAll(server.EncodeServerMessage(&message.CloseResponses{}))
+		g.declareTiebreakerWinner(g.quesState.playerAnswering)
+		return
+	}
+
+	g.quesState.alreadyAnswered = append(g.quesState.alreadyAnswered, g.quesState.playerAnswering)
+	if len(g.quesState.alreadyAnswered) >= len(g.tiebreaker.players) {
+		g.gameState.currentStatus = STATUS_TIEBREAKER
+		g.room.MessageAll(server.EncodeServerMessage(&message.CloseResponses{}))
+		return
+	}
+
+	g.openResponses()
+}
+
+func (g *GameDriver) declareTiebreakerWinner(name string) {
+	g.tiebreaker.winner = name
+	g.room.MessageAll(server.EncodeServerMessage(&message.TiebreakerWinner{Name: name}))
+	g.finishGame(name)
+}
+
+func (g *GameDriver) OnMoveOnMessageConcludeGame(name string, host bool, msg message.ClientMessage) error {
+	g.gameState.mu.Lock()
+	defer g.gameState.mu.Unlock()
+
+	if !host {
+		return nil
+	}
+
+	switch g.gameState.currentStatus {
+	case STATUS_SHOWING_OWARI:
+		if !g.owariResolved() {
+			e := server.EncodeServerMessage(&message.ServerError{Error: "Mark every Owari answer before moving on", Code: 2006})
+			g.room.MessagePlayer(e, name)
+			return nil
+		}
+		g.concludeGame()
+	case STATUS_TIEBREAKER:
+		g.presentTiebreakerQuestion()
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package game
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/baconstrip/kiken/common"
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/server"
+)
+
+// tieOwari plays Owari so that "a" and "b" finish tied for first with 1500,
+// ahead of "c" with 800, and leaves the game showing the Owari results.
+func tieOwari(t *testing.T, g *GameDriver) {
+	t.Helper()
+	bids := map[string]int{"a": 500, "b": 500, "c": 200}
+	for _, name := range []string{"a", "b", "c"} {
+		send(t, g.OnEnterBidAddBid, name, false, &message.EnterBid{Money: bids[name]})
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		send(t, g.OnFreeformAnswerAddAnswerOwari, name, false, &message.FreeformAnswer{Message: "answer"})
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		send(t, g.OnMarkOwariAnswerMessageScore, "host", true, &message.MarkOwariAnswer{Name: name, Correct: name != "c"})
+	}
+	if g.gameState.currentStatus != STATUS_SHOWING_OWARI {
+		t.Fatalf("status after Owari = %v, want %v", g.gameState.currentStatus, STATUS_SHOWING_OWARI)
+	}
+}
+
+// answerTiebreaker has each of buzzers buzz in to the tiebreaker question open
+// for answers, and answer in turn. Only correct's answer is marked correct.
+func answerTiebreaker(t *testing.T, g *GameDriver, buzzers []string, correct string) {
+	t.Helper()
+	for _, name := range buzzers {
+		send(t, g.OnAttemptAnswerMessageAllowAnswer, name, false, &message.AttemptAnswer{ResponseTime: 100})
+		if err := g.TimedSelectPlayerToAnswer(); err != nil {
+			t.Fatalf("TimedSelectPlayerToAnswer() failed: %v", err)
+		}
+		if g.gameState.currentStatus != STATUS_PLAYERS_ANSWERING || g.quesState.playerAnswering != name {
+			t.Fatalf("%v isn't answering the tiebreaker, status %v", name, g.gameState.currentStatus)
+		}
+		send(t, g.OnMarkAnswerMessageMoveAlong, "host", true, &message.MarkAnswer{Correct: name == correct, Attempt: g.gameState.answerAttempt})
+	}
+}
+
+func TestTiebreaker(t *testing.T) {
+	g := newTestGame(t, Configuration{StartingPhase: "owari"}, "a", "b", "c")
+	tieOwari(t, g)
+
+	send(t, g.OnMoveOnMessageConcludeGame, "host", true, &message.MoveOn{})
+	if g.gameState.currentStatus != STATUS_TIEBREAKER || g.gameState.currentRound != common.TIEBREAKER {
+		t.Fatalf("after a tied Owari, status %v in round %v, want %v in %v", g.gameState.currentStatus, g.gameState.currentRound, STATUS_TIEBREAKER, common.TIEBREAKER)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(g.tiebreaker.players, want) {
+		t.Errorf("tiebreaker players = %v, want %v", g.tiebreaker.players, want)
+	}
+
+	// Nobody gets the first question, so the host moves on to another.
+	send(t, g.OnMoveOnMessageConcludeGame, "host", true, &message.MoveOn{})
+	if got := g.quesState.question.Data.ID; got != "extra0" {
+		t.Fatalf("first tiebreaker question = %v, want extra0", got)
+	}
+	send(t, g.OnFinishReadingMessageBeginCountdown, "host", true, &message.FinishReading{})
+	answerTiebreaker(t, g, []string{"a", "b"}, "")
+	if g.gameState.currentStatus != STATUS_TIEBREAKER {
+		t.Fatalf("status after nobody answered = %v, want %v", g.gameState.currentStatus, STATUS_TIEBREAKER)
+	}
+
+	send(t, g.OnMoveOnMessageConcludeGame, "host", true, &message.MoveOn{})
+	if got := g.quesState.question.Data.ID; got != "spare0" {
+		t.Fatalf("second tiebreaker question = %v, want spare0", got)
+	}
+	send(t, g.OnFinishReadingMessageBeginCountdown, "host", true, &message.FinishReading{})
+	send(t, g.OnAttemptAnswerMessageAllowAnswer, "c", false, &message.AttemptAnswer{ResponseTime: 50})
+	if _, ok := g.quesState.attemptedBuzzes["c"]; ok {
+		t.Errorf("c buzzed in to the tiebreaker without being tied for first")
+	}
+	answerTiebreaker(t, g, []string{"a", "b"}, "b")
+
+	if g.gameState.currentStatus != STATUS_GAME_OVER {
+		t.Fatalf("status after the tiebreaker was answered = %v, want %v", g.gameState.currentStatus, STATUS_GAME_OVER)
+	}
+	if g.gameOver.Winner != "b" || g.tiebreaker.winner != "b" {
+		t.Errorf("winner = %q, want b", g.gameOver.Winner)
+	}
+	for name, want := range map[string]int{"a": 1500, "b": 1500, "c": 800} {
+		if got := g.metagame.players[name].Money; got != want {
+			t.Errorf("%v has %v after the tiebreaker, want %v", name, got, want)
+		}
+	}
+	if first := g.gameOver.Standings[0]; first.Name != "b" || first.Rank != 1 {
+		t.Errorf("first in standings = %+v, want b ranked 1", first)
+	}
+}
+
+func TestRestoreTiebreaker(t *testing.T) {
+	g := newTestGame(t, Configuration{StartingPhase: "owari", SavePath: filepath.Join(t.TempDir(), "game.json")}, "a", "b", "c")
+	tieOwari(t, g)
+	send(t, g.OnMoveOnMessageConcludeGame, "host", true, &message.MoveOn{})
+	send(t, g.OnMoveOnMessageConcludeGame, "host", true, &message.MoveOn{})
+	g.save()
+
+	r, err := server.New("", server.Credentials{}, 0, nil).CreateRoom("restored")
+	if err != nil {
+		t.Fatalf("CreateRoom() failed: %v", err)
+	}
+	m := NewMetaGameDriver(NewBoardGenerator(nil, GeneratorOptions{}, nil), nil, r, g.config)
+	if err := m.Restore(); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	restored := m.gameDriver
+	t.Cleanup(func() {
+		restored.gameState.mu.Lock()
+		restored.stopTimers()
+		restored.gameState.mu.Unlock()
+		restored.saver.stop()
+	})
+
+	// The question in progress can't be resumed, so the host is left to move
+	// on to a fresh one, which only the tied players may answer.
+	if restored.gameState.currentStatus != STATUS_TIEBREAKER || !restored.inTiebreaker() {
+		t.Fatalf("restored status %v in round %v, want %v in the tiebreaker", restored.gameState.currentStatus, restored.gameState.currentRound, STATUS_TIEBREAKER)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(restored.tiebreaker.players, want) {
+		t.Errorf("restored tiebreaker players = %v, want %v", restored.tiebreaker.players, want)
+	}
+
+	send(t, restored.OnMoveOnMessageConcludeGame, "host", true, &message.MoveOn{})
+	if got := restored.quesState.question.Data.ID; got != "spare0" {
+		t.Errorf("tiebreaker question after restoring = %v, want spare0", got)
+	}
+	send(t, restored.OnFinishReadingMessageBeginCountdown, "host", true, &message.FinishReading{})
+	send(t, restored.OnAttemptAnswerMessageAllowAnswer, "c", false, &message.AttemptAnswer{ResponseTime: 50})
+	if _, ok := restored.quesState.attemptedBuzzes["c"]; ok {
+		t.Errorf("c buzzed in to the restored tiebreaker without being tied for first")
+	}
+}
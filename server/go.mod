@@ -4,5 +4,6 @@ go 1.16
 
 require (
 	github.com/kr/pretty v0.2.1
+	golang.org/x/crypto v0.0.0-20220722155217-630584e8d5aa
 	golang.org/x/net v0.0.0-20220722155237-a158d28d115b
 )
@@ -1,9 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"io/fs"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/baconstrip/kiken/editor"
 	"github.com/baconstrip/kiken/game"
@@ -13,15 +22,42 @@ import (
 )
 
 var (
-	flagStaticPath = flag.String("static-path", "../keeken-client/dist", "Path to static content files")
-	flagPort       = flag.Int("port", 1986, "Port for the server to listen on")
+	flagStaticPath      = flag.String("static-path", "../keeken-client/dist", "Path to static content files")
+	flagPort            = flag.Int("port", 1986, "Port for the server to listen on")
+	flagBind            = flag.String("bind", "", "Address for the server to listen on, defaults to every address")
+	flagTLSCert         = flag.String("tls-cert", "", "If set with -tls-key, path to the certificate to serve TLS with")
+	flagTLSKey          = flag.String("tls-key", "", "If set with -tls-cert, path to the key to serve TLS with")
+	flagCookieSecure    = flag.Bool("cookie-secure", false, "Only send session cookies over HTTPS, always set when serving TLS")
+	flagCookieHTTPOnly  = flag.Bool("cookie-httponly", true, "Hide session cookies from scripts in the page")
+	flagShutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "How long to wait for connections to close when shutting down")
+	flagCookieSameSite  = flag.String("cookie-samesite", "lax", "SameSite attribute of session cookies, one of: lax, strict, none, default")
 	// flagQuestionsList  = flag.String("question-list", "", "Path to list of questions, must be set")
-	flagQuestionSource = flag.String("question-source", "", "Path to source for questions")
-	flagPasscode       = flag.String("passcode", "test", "Passcode to use to grant admin privledges")
-	flagDataDir        = flag.String("data-dir", "../data", "Path to location to store shows")
-	flagStartAt        = flag.String("start-at", "", "If set, the server will start the game at the specified stage, for testing purposes.")
+	flagQuestionSource    = flag.String("question-source", "", "Path to source for questions")
+	flagPasscode          = flag.String("passcode", "test", "Passcode for hosts and editors, unless -host-passcode or -editor-passcode is set")
+	flagHostPasscode      = flag.String("host-passcode", "", "Passcode needed to host games, defaults to -passcode")
+	flagEditorPasscode    = flag.String("editor-passcode", "", "Passcode needed to use the show editor, defaults to -passcode")
+	flagSpectatorPasscode = flag.String("spectator-passcode", "", "If set, passcode needed to spectate games, instead of -room-passcode")
+	flagRoomPasscode      = flag.String("room-passcode", "", "If set, passcode needed to join games as a player")
+	flagHeartbeatInterval = flag.Duration("heartbeat-interval", 5*time.Second, "How often clients are sent heartbeats, 0 to send none")
+	flagHeartbeatTimeout  = flag.Duration("heartbeat-timeout", 30*time.Second, "How long a client that answers heartbeats can go unheard from before it's disconnected, 0 to never disconnect")
+	flagDataDir           = flag.String("data-dir", "../data", "Path to location to store shows")
+	flagStartAt           = flag.String("start-at", "", "If set, the server will start the game at the specified stage, for testing purposes.")
+	flagRestore           = flag.Bool("restore", false, "If set, the server will restore the game in progress when it last stopped.")
+	flagAnswerTimeout     = flag.String("answer-timeout", "mark-incorrect", "What happens when a player runs out of time to answer, one of: mark-incorrect, alert-host")
+	flagSeed              = flag.Int64("seed", 0, "If set, seeds the random choice of categories so the same games are generated every run.")
+	flagAvoidRecent       = flag.Int("avoid-recent", 3, "Number of recent games whose categories are avoided when generating games")
+	flagMinShowing        = flag.Int("min-showing", 0, "If set, generated games only use questions from this showing or later.")
+	flagMaxShowing        = flag.Int("max-showing", 0, "If set, generated games only use questions from this showing or earlier.")
+	flagAvoidPlayed       = flag.Bool("avoid-played", true, "Avoid questions that have been played in previous games when generating games")
 )
 
+var validSameSite = map[string]http.SameSite{
+	"lax":     http.SameSiteLaxMode,
+	"strict":  http.SameSiteStrictMode,
+	"none":    http.SameSiteNoneMode,
+	"default": http.SameSiteDefaultMode,
+}
+
 var validStartStage map[string]interface{} = map[string]interface{}{
 	"owari":   nil,
 	"daiichi": nil,
@@ -53,6 +89,11 @@ func main() {
 		*flagStartAt = "daiichi"
 	}
 
+	answerTimeout, err := game.ParseAnswerTimeoutAction(*flagAnswerTimeout)
+	if err != nil {
+		log.Fatalf("Invalid answer-timeout specified: %v", err)
+	}
+
 	// Assign the global dataDir for the editor
 	editor.DataDir = dataDir
 
@@ -62,19 +103,161 @@ func main() {
 	}
 	log.Printf("Found %v files in the saved data.", dataFileCount)
 
-	log.Printf("Starting Kiken server on port %v", *flagPort)
+	// State for games in progress is kept apart from shows, so the editor
+	// doesn't mistake it for one.
+	stateDir := filepath.Join(dataDir, "state")
+	if err := os.MkdirAll(stateDir, 0o755); err != nil {
+		log.Fatalf("Could not create state dir: %v", err)
+	}
+
+	// Games were saved to a single file before the server hosted several
+	// rooms, that game now belongs to the default room.
+	legacySave := filepath.Join(stateDir, "game.json")
+	defaultSave := filepath.Join(stateDir, "game-"+server.DefaultRoom+".json")
+	if _, err := os.Stat(defaultSave); os.IsNotExist(err) {
+		if err := os.Rename(legacySave, defaultSave); err == nil {
+			log.Printf("Moved saved game to %v", defaultSave)
+		}
+	}
+
+	listen := server.ListenOptions{
+		Host:     *flagBind,
+		CertFile: *flagTLSCert,
+		KeyFile:  *flagTLSKey,
+	}
+	if listen.TLS() && (listen.CertFile == "" || listen.KeyFile == "") {
+		log.Fatalf("Both -tls-cert and -tls-key must be set to serve TLS")
+	}
+
+	sameSite, ok := validSameSite[strings.ToLower(*flagCookieSameSite)]
+	if !ok {
+		log.Fatalf("Invalid cookie-samesite specified: %v", *flagCookieSameSite)
+	}
+	cookies := server.CookieOptions{
+		Secure:   *flagCookieSecure || listen.TLS(),
+		HTTPOnly: *flagCookieHTTPOnly,
+		SameSite: sameSite,
+	}
+	// Browsers reject cookies with SameSite=None unless they're secure.
+	if cookies.SameSite == http.SameSiteNoneMode && !cookies.Secure {
+		log.Fatalf("cookie-samesite none requires TLS or -cookie-secure")
+	}
+
+	if listen.TLS() {
+		log.Printf("Starting Kiken server with TLS on port %v", *flagPort)
+	} else {
+		log.Printf("Starting Kiken server on port %v", *flagPort)
+	}
 
-	gameLm := server.NewListenerManager()
-	globalLm := server.NewListenerManager()
 	editorLm := server.NewListenerManager()
 
-	s := server.New(*flagStaticPath, *flagPasscode, *flagPort, globalLm, gameLm, editorLm)
+	creds := server.Credentials{
+		Host:      *flagHostPasscode,
+		Editor:    *flagEditorPasscode,
+		Spectator: *flagSpectatorPasscode,
+		Room:      *flagRoomPasscode,
+	}
+	if creds.Host == "" {
+		creds.Host = *flagPasscode
+	}
+	if creds.Editor == "" {
+		creds.Editor = *flagPasscode
+	}
+	s := server.New(*flagStaticPath, creds, *flagPort, editorLm)
+	s.SetCookieOptions(cookies)
+	s.SetHeartbeat(*flagHeartbeatInterval, *flagHeartbeatTimeout)
+
+	// Hosts may play any show saved by the editor, or a game generated from
+	// the question pool.
+	shows := editor.NewLibrary(dataDir)
+	history, err := game.LoadPlayHistory(filepath.Join(stateDir, "history.json"))
+	if err != nil {
+		log.Fatalf("Could not load play history: %v", err)
+	}
+	log.Printf("%v questions have been played before", history.Len())
+	generator := game.NewBoardGenerator(q, game.GeneratorOptions{
+		Seed:        *flagSeed,
+		AvoidRecent: *flagAvoidRecent,
+		MinShowing:  *flagMinShowing,
+		MaxShowing:  *flagMaxShowing,
+		AvoidPlayed: *flagAvoidPlayed,
+	}, history)
+
+	// Every room plays its own game, saved to its own file.
+	s.SetRoomInitializer(func(r *server.Room) {
+		config := game.DefaultConfiguration()
+		config.StartingPhase = *flagStartAt
+		config.AnswerTimeoutAction = answerTimeout
+		config.SavePath = filepath.Join(stateDir, "game-"+r.Code()+".json")
+
+		metagame := game.NewMetaGameDriver(generator, shows, r, config)
+		if *flagRestore {
+			if err := metagame.Restore(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Printf("Could not restore game in room %v, starting fresh: %v", r.Code(), err)
+			}
+		}
+		metagame.Start()
+		r.OnShutdown(metagame.Shutdown)
+	})
+
+	// Tokens are signed with a saved key, so they last as long as the
+	// sessions they were issued for. Sessions are only kept across a restart
+	// if they're restored, so otherwise the key is replaced, and tokens issued
+	// before the restart stop working too.
+	tokenKeyPath := filepath.Join(stateDir, "token.key")
+	if !*flagRestore {
+		if err := os.Remove(tokenKeyPath); err != nil && !os.IsNotExist(err) {
+			log.Fatalf("Could not replace token key: %v", err)
+		}
+	}
+	tokenKey, err := server.LoadTokenKey(tokenKeyPath)
+	if err != nil {
+		log.Fatalf("Could not load token key: %v", err)
+	}
+	if err := s.UseTokenKey(tokenKey); err != nil {
+		log.Fatalf("Could not use token key: %v", err)
+	}
 
-	metagame := game.NewMetaGameDriver(q, s, *flagStartAt, gameLm, globalLm)
-	metagame.Start()
+	sessions, err := server.NewFileSessionStore(filepath.Join(stateDir, "sessions.json"))
+	if err != nil {
+		log.Fatalf("Could not open session store: %v", err)
+	}
+	if err := s.UseSessionStore(sessions, *flagRestore); err != nil {
+		log.Printf("Starting without previous sessions: %v", err)
+	}
+	if _, err := s.CreateRoom(server.DefaultRoom); err != nil {
+		log.Fatalf("Could not create default room: %v", err)
+	}
 
 	editor := editor.NewEditorDriver(s, editorLm)
 	editor.Start()
 
-	log.Fatal(s.ListenAndServe())
+	// Shut down gracefully on interrupt, so games in progress are saved and
+	// clients are told why they were disconnected.
+	stopped := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		sig := <-signals
+		log.Printf("Received %v, shutting down", sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), *flagShutdownTimeout)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			log.Printf("Failed to shut down cleanly: %v", err)
+		}
+		if err := history.Flush(); err != nil {
+			log.Printf("Failed to save play history: %v", err)
+		}
+		if err := sessions.Flush(); err != nil {
+			log.Printf("Failed to save sessions: %v", err)
+		}
+		close(stopped)
+	}()
+
+	if err := s.ListenAndServe(listen); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
+	log.Printf("Server stopped")
 }
@@ -77,6 +77,25 @@ type PlayerAnswering struct {
 	// Interval is the time in milliseconds that a player is given to answer a
 	// question.
 	Interval int
+	// Attempt identifies this attempt to answer, so that hosts can say which
+	// attempt they're marking.
+	Attempt int
+}
+
+// BeginPachi is a message that the server sends to clients when a pachi
+// question has been selected. Only the player given by Name may answer it, and
+// they must first wager between zero and MaxBid.
+type BeginPachi struct {
+	Name     string
+	Category string
+	MaxBid   int
+}
+
+// AnswerTimeExpired is sent to the host when the player given by Name has run
+// out of time to answer, and the server is configured to leave marking the
+// answer to the host.
+type AnswerTimeExpired struct {
+	Name string
 }
 
 // UpdatePlayers is a message sent by the server to refresh the players on a
@@ -98,11 +117,31 @@ type Player struct {
 }
 
 // HostAdd is a message sent by the server when the host joins or to set the
-// host for a player that has just joined.
+// host for a player that has just joined. Name is the host in control of the
+// game, even if there are co-hosts.
 type HostAdd struct {
 	Name string
 }
 
+// UpdateHosts is sent to every client when hosts join, leave, or hand over
+// control. Host is the host in control of the game, and CoHosts are the other
+// hosts, who see everything the host sees and can run play, but can't cancel
+// the game or remove anyone from it.
+type UpdateHosts struct {
+	Host    string
+	CoHosts []Player
+}
+
+// AnswerMarked is sent to the hosts when one of them marks an answer, so that
+// the others know it's been dealt with.
+type AnswerMarked struct {
+	// Name is the player whose answer was marked.
+	Name     string
+	Correct  bool
+	Attempt  int
+	MarkedBy string
+}
+
 // ServerError is sent to the client when the server fails to handle a request.
 type ServerError struct {
 	Error string
@@ -111,6 +150,10 @@ type ServerError struct {
 
 type AuthSuccess struct {
 	Msg string
+	// Token identifies the new session, for clients that can't use the
+	// session cookie. It's sent in an "Authorization: Bearer" header, or in
+	// the "token" query parameter when connecting to a websocket.
+	Token string
 }
 
 // BeginOwari is sent to the clients to indicate the beginning of the endgame.
@@ -126,17 +169,118 @@ type ShowOwariPrompt struct {
 	Prompt *QuestionPrompt
 }
 
+// ShowOwariResults is sent to the clients once all Owari answers are in. The
+// host receives every answer, while players only receive answers as the host
+// marks them, along with whether they were correct.
 type ShowOwariResults struct {
 	Answers map[string]string
 	Bids    map[string]int
+	Correct map[string]bool
+}
+
+// RevealOwariAnswer is sent to the clients when the host marks a player's
+// Owari answer.
+type RevealOwariAnswer struct {
+	Name    string
+	Answer  string
+	Bid     int
+	Correct bool
+}
+
+// GameOver is sent to the clients when the game has finished, with the final
+// standings ordered from first place to last.
+type GameOver struct {
+	// Winner is empty if the game ended in a tie.
+	Winner    string
+	Standings []*Standing
+}
+
+// Standing messages are not sent directly, but are embedded in a GameOver
+// message to describe a player's final position. Players with the same Money
+// share a Rank, unless one of them won a tiebreaker.
+type Standing struct {
+	Name  string
+	Money int
+	Rank  int
 }
 
 type ClearBoard struct{}
 
+// GamePaused is sent to the clients when the host pauses the game. Interval is
+// the time in milliseconds that was left on the countdown in progress, or zero
+// if there was none.
+type GamePaused struct {
+	Interval int
+}
+
+// GameResumed is sent to the clients when the host resumes the game. Clients
+// should restart the countdown in progress with the time in milliseconds given
+// by Interval.
+type GameResumed struct {
+	Interval int
+}
+
+// HistoryReset is sent to the host after the history of played questions has
+// been cleared. Forgotten is the number of questions that were in it.
+type HistoryReset struct {
+	Forgotten int
+}
+
+// SessionRevoked is sent to a client just before it's disconnected because the
+// host revoked its session. The client must sign in again to rejoin.
+type SessionRevoked struct{}
+
+// ServerShutdown is sent to every client just before the server shuts down and
+// closes their connections. Clients can reconnect once it's back.
+type ServerShutdown struct{}
+
+// Kicked is sent to a client just before it's disconnected because the host
+// removed it from the game. If Banned is set, it can't rejoin until the game
+// ends.
+type Kicked struct {
+	Banned bool
+}
+
+// BeginTiebreaker is sent to the clients when Owari ends with more than one
+// player tied for first place. Only the players named in Players may answer
+// tiebreaker questions.
+type BeginTiebreaker struct {
+	Players []string
+}
+
+// TiebreakerWinner is sent to the clients when a player answers a tiebreaker
+// question correctly. Name is empty if the tiebreaker questions ran out before
+// anyone did.
+type TiebreakerWinner struct {
+	Name string
+}
+
+// ShowSelected is sent to the clients when the host chooses the show that the
+// next game will be played from. ID is "random" when the game will be made from
+// the question pool.
+type ShowSelected struct {
+	ID   string
+	Name string
+}
+
+// Heartbeat is sent to every client periodically. Clients should answer each
+// with a HeartbeatAck carrying the same Seq, so that the server can tell they're
+// still connected and how long messages take to reach them.
+type Heartbeat struct {
+	Seq int
+}
+
+// PlayerLatency is sent to the hosts periodically with the round trip time, in
+// milliseconds, of each client in the room that answers heartbeats.
+type PlayerLatency struct {
+	Latencies map[string]int
+}
+
 // ------- EDITOR MESSAGES --------
 
 // AvailableShows is a response to the client's request for shows, and contains
-// a map of show IDs to names
+// a map of show IDs to names. It's also sent to the host of a game, to choose
+// the show to play.
 type AvailableShows struct {
 	Shows map[string]string
 }
@@ -147,7 +291,49 @@ type SetEditorError struct {
 	Code    int
 }
 
+// UpdateEditorBoards is sent to the editors with a show open when one of them
+// opens or closes it, and after every change any of them make to it, with the
+// show's boards in full.
 type UpdateEditorBoards struct {
+	ShowID string
+	Name   string
+	Title  string
+	Author string
+	Notes  string
+	// Created and Modified are when the show was created and last saved, in
+	// seconds since the Unix epoch.
+	Created  int64
+	Modified int64
+	Rounds   []*EditorBoard
+	// Editors are the names of the editors with the show open.
+	Editors []string
+	// EditedBy is the name of the editor whose change this is, or empty if it
+	// isn't for a change.
+	EditedBy string
+}
+
+// EditorBoard is the board of one round of a show, as shown in the editor.
+type EditorBoard struct {
+	Round      string
+	Categories []*EditorCategory
+}
+
+// EditorCategory is a category in a show, as shown in the editor.
+type EditorCategory struct {
+	Name    string
+	Comment string
+	Clues   []*EditorClue
+}
+
+// EditorClue is a clue in a show, as shown in the editor. Revision counts the
+// changes made to the clue since the show was opened, and must be given back
+// to change it, so that editors can't unknowingly overwrite each other.
+type EditorClue struct {
+	ID       string
+	Revision int
+	Value    int
+	Question string
+	Answer   string
 }
 
 // ------- BEGIN CLIENT MESSAGES --------
@@ -155,12 +341,17 @@ type UpdateEditorBoards struct {
 // AuthInfo defines a message that the client sends to the server to provide
 // authentication information.
 type AuthInfo struct {
-	Name           string
+	Name string
+	// ServerPasscode is the passcode the server needs for the role the
+	// client is signing in with. See server.Credentials.
 	ServerPasscode string
-	Passcode       string
-	Host           bool
-	Editor         bool
-	Spectator      bool
+	// Passcode is the player's own passcode, which they use to rejoin.
+	Passcode  string
+	Host      bool
+	Editor    bool
+	Spectator bool
+	// Room is the code of the room to join, or to open when joining as a host.
+	Room string
 }
 
 // SelectQuestion is a message that the clients sends to indicate the question
@@ -173,6 +364,11 @@ type SelectQuestion struct {
 // players' answer is correct and to indicate that answering period is over.
 type MarkAnswer struct {
 	Correct bool
+	// Attempt is the attempt being marked, from PlayerAnswering. If that
+	// attempt has already been marked, the mark is rejected, so that two hosts
+	// can't both mark the same answer. Marks without it are only accepted from
+	// the host in control of the game.
+	Attempt int
 }
 
 // FinishReading is a message that the host client sends when to indicate they
@@ -206,6 +402,14 @@ type EnterBid struct {
 	Money int
 }
 
+// MarkOwariAnswer is a message that the host client sends to decide whether
+// the Owari answer from the player given by Name is correct. Answers are marked
+// one at a time, and each is revealed to the players as it's marked.
+type MarkOwariAnswer struct {
+	Name    string
+	Correct bool
+}
+
 // FreeformAnswer is a message that a player sends to enter a free form text
 // message.
 type FreeformAnswer struct {
@@ -220,21 +424,186 @@ type ClientTestMessage struct {
 // CancelGame is for the host to indicate the current game should be closed.
 type CancelGame struct{}
 
+// Pause is for the host to stop play, freezing any countdown in progress.
+type Pause struct{}
+
+// Resume is for the host to continue play after a Pause.
+type Resume struct{}
+
+// ResetHistory is for the host to forget which questions have been played, so
+// that generated games may use them again.
+type ResetHistory struct{}
+
+// RevokeSession is for the host to end the session of the named player or
+// spectator, disconnecting them.
+type RevokeSession struct {
+	Name string
+}
+
+// TransferHost is for the host in control of the game to hand control to the
+// co-host given by Name. If the host in control has disconnected, a co-host
+// may take control by giving their own name.
+type TransferHost struct {
+	Name string
+}
+
+// KickPlayer is for the host to remove the named player or spectator from the
+// game, disconnecting them. They may sign in again to rejoin.
+type KickPlayer struct {
+	Name string
+}
+
+// BanPlayer is for the host to remove the named player or spectator from the
+// game, and stop them rejoining with that name until the game ends. If
+// BanAddress is set, nobody can rejoin from the address they signed in from
+// either.
+type BanPlayer struct {
+	Name       string
+	BanAddress bool
+}
+
+// HeartbeatAck answers the Heartbeat from the server with the same Seq.
+type HeartbeatAck struct {
+	Seq int
+}
+
 // ---- EDITOR MESSAGES -----
 // Requests that the server show the shows available
 type RequestShows struct{}
 
-// Tells the server to select a show for editing
+// Tells the server to select a show for editing, or when sent by the host of a
+// game, the show to play next.
 type SelectShow struct {
 	ShowID string
 }
 
-// Tells the server to add a new category for editing
+// Tells the server to add a new category for editing, at the end of the
+// board for Round. Categories can only be added to the daiichi and daini
+// rounds; the Owari clue is set with SetOwari.
 type AddCategory struct {
 	Name  string
 	Round string
 }
 
+// CreateShow creates an empty show named Name, and opens it for editing.
+type CreateShow struct {
+	Name string
+}
+
+// RenameShow renames the show with ID ShowID to Name. The show's ID changes
+// with its name.
+type RenameShow struct {
+	ShowID string
+	Name   string
+}
+
+// DuplicateShow copies the show with ID ShowID to a new show named Name, and
+// opens the copy for editing.
+type DuplicateShow struct {
+	ShowID string
+	Name   string
+}
+
+// DeleteShow deletes the show with ID ShowID. Confirm must be the show's name,
+// so that a show can't be deleted by mistake.
+type DeleteShow struct {
+	ShowID  string
+	Confirm string
+}
+
+// SetShowInfo replaces the title, author and notes of the open show. If Title
+// is empty, the show's name is used.
+type SetShowInfo struct {
+	Title  string
+	Author string
+	Notes  string
+}
+
+// SetCategoryComment replaces the comment on the category at index Category of
+// the board for Round. Comments are only shown in the editor.
+type SetCategoryComment struct {
+	Round    string
+	Category int
+	Current  string
+	Comment  string
+}
+
+// RenameCategory renames the category at index Category of the board for Round.
+// Current must be the category's name, from the last UpdateEditorBoards, or the
+// change is rejected because someone else changed the board first.
+type RenameCategory struct {
+	Round    string
+	Category int
+	Current  string
+	Name     string
+}
+
+// DeleteCategory removes the category at index Category of the board for
+// Round, along with its clues. Current must be the category's name, as for
+// RenameCategory.
+type DeleteCategory struct {
+	Round    string
+	Category int
+	Current  string
+}
+
+// MoveCategory moves the category at index Category of the board for Round so
+// that it's at index To. Current must be the category's name, as for
+// RenameCategory.
+type MoveCategory struct {
+	Round    string
+	Category int
+	Current  string
+	To       int
+}
+
+// AddClue adds a clue to the category at index Category of the board for
+// Round. Current must be the category's name, as for RenameCategory.
+type AddClue struct {
+	Round    string
+	Category int
+	Current  string
+	Value    int
+	Question string
+	Answer   string
+}
+
+// EditClue replaces the value, question and answer of the clue at index Clue
+// in the category at index Category of the board for Round. ID and Revision
+// must be the clue's, from the last UpdateEditorBoards, or the edit is
+// rejected because someone else changed the clue first.
+type EditClue struct {
+	Round    string
+	Category int
+	Clue     int
+	ID       string
+	Revision int
+	Value    int
+	Question string
+	Answer   string
+}
+
+// DeleteClue removes the clue at index Clue in the category at index Category
+// of the board for Round. ID and Revision must be the clue's, as for EditClue.
+type DeleteClue struct {
+	Round    string
+	Category int
+	Clue     int
+	ID       string
+	Revision int
+}
+
+// SetOwari replaces the show's Owari clue. ID and Revision must be the current
+// Owari clue's, from the last UpdateEditorBoards, as for EditClue, and ID must
+// be empty if the show doesn't have one yet.
+type SetOwari struct {
+	ID       string
+	Revision int
+	Category string
+	Question string
+	Answer   string
+}
+
 type AdjustScore struct {
 	PlayerName string
 	Amount     int
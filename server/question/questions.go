@@ -33,6 +33,9 @@ type Category struct {
 	Name      string
 	Round     common.Round
 	Questions []*Question
+	// Comment is a note about the category from the author of the show it's
+	// from, for the editor only.
+	Comment string
 }
 
 // ByValue implements a type that allows sorting Questions by their value.
@@ -123,6 +126,13 @@ func CollateLoneQuestions(questions []*Question, r common.Round) []*Category {
 	return categories
 }
 
+// NewID returns the ID of the question with the given prompt in category.
+func NewID(prompt, category string) string {
+	hasher := sha512.New()
+	hasher.Write([]byte(prompt + category))
+	return base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+}
+
 func decodeQuestions(i *interface{}) ([]*Question, error) {
 	var retVal []*Question
 	switch (*i).(type) {
@@ -176,10 +186,6 @@ func decodeQuestions(i *interface{}) ([]*Question, error) {
 			continue
 		}
 
-		hasher := sha512.New()
-		hasher.Write([]byte(prompt + category))
-		sha := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
-
 		if answer == "" {
 			answer = "&lt;No answer provided&rt;"
 		}
@@ -192,7 +198,7 @@ func decodeQuestions(i *interface{}) ([]*Question, error) {
 			Round:    round,
 			Showing:  showing,
 
-			ID: sha,
+			ID: NewID(prompt, category),
 		}
 
 		retVal = append(retVal, question)
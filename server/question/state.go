@@ -85,6 +85,32 @@ func (q *QuestionState) Snapshot() *QuestionStateSnapshot {
 	}
 }
 
+// ToQuestion recreates the question the snapshot was taken from.
+func (q *QuestionStateSnapshot) ToQuestion() *Question {
+	return &Question{
+		Category: q.Category,
+		Value:    q.Value,
+		Question: q.Question,
+		Answer:   q.Answer,
+		Round:    q.Round,
+		Showing:  q.Showing,
+
+		ID: q.ID,
+	}
+}
+
+// ToCategory recreates the category the snapshot was taken from.
+func (c *CategoryStateSnapshot) ToCategory() *Category {
+	cat := &Category{
+		Name:  c.Name,
+		Round: c.Round,
+	}
+	for _, q := range c.Questions {
+		cat.Questions = append(cat.Questions, q.ToQuestion())
+	}
+	return cat
+}
+
 func (q *QuestionStateSnapshot) ToQuestionPrompt(includeAnswer bool) *message.QuestionPrompt {
 	if includeAnswer {
 		return &message.QuestionPrompt{
@@ -13,6 +13,19 @@ var potentialValueRanges = [][]int{
 	{400, 800, 1200, 1600, 2000},
 }
 
+// RoundValues returns the values of the questions in a category in round, in
+// order, or nil if the round has no standard values.
+func RoundValues(round common.Round) []int {
+	switch round {
+	case common.DAIICHI:
+		return append([]int(nil), potentialValueRanges[1]...)
+	case common.DAINI:
+		return append([]int(nil), potentialValueRanges[2]...)
+	default:
+		return nil
+	}
+}
+
 // FixValues corrects duplicate values, fixes values that sit outside the
 // normal procession, and changes the values so that they match the numbers
 // used in normal play.
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/util"
+)
+
+// Credentials are the passcodes clients give to sign in with each role. Hosts
+// and editors always need a passcode, and can't sign in if theirs is empty.
+// Players and spectators only need one if it's set.
+type Credentials struct {
+	// Host is the passcode needed to open rooms and host games.
+	Host string
+	// Editor is the passcode needed to use the show editor.
+	Editor string
+	// Spectator is the passcode needed to spectate games. If it's empty,
+	// spectators need the Room passcode instead.
+	Spectator string
+	// Room is the passcode needed to join games as a player.
+	Room string
+}
+
+// passcodeFor returns the passcode a client signing in with info needs, and
+// whether one is needed at all.
+func (c Credentials) passcodeFor(info *message.AuthInfo) (string, bool) {
+	switch {
+	case info.Editor:
+		return c.Editor, true
+	case info.Host:
+		return c.Host, true
+	case info.Spectator && c.Spectator != "":
+		return c.Spectator, true
+	default:
+		return c.Room, c.Room != ""
+	}
+}
+
+// allows returns whether a client signing in with info gave the passcode for
+// its role.
+func (c Credentials) allows(info *message.AuthInfo) bool {
+	passcode, required := c.passcodeFor(info)
+	if !required {
+		return true
+	}
+	return passcode != "" && util.EqualSecrets(info.ServerPasscode, passcode)
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/baconstrip/kiken/message"
+)
+
+func TestCredentialsAllows(t *testing.T) {
+	creds := Credentials{Host: "host", Editor: "editor", Spectator: "watch"}
+	tests := []struct {
+		desc string
+		info message.AuthInfo
+		want bool
+	}{
+		{"host", message.AuthInfo{Host: true, ServerPasscode: "host"}, true},
+		{"host with editor passcode", message.AuthInfo{Host: true, ServerPasscode: "editor"}, false},
+		{"editor", message.AuthInfo{Editor: true, ServerPasscode: "editor"}, true},
+		{"editor with host passcode", message.AuthInfo{Editor: true, ServerPasscode: "host"}, false},
+		{"spectator", message.AuthInfo{Spectator: true, ServerPasscode: "watch"}, true},
+		{"spectator without passcode", message.AuthInfo{Spectator: true}, false},
+		{"player without room passcode", message.AuthInfo{}, true},
+	}
+	for _, tc := range tests {
+		if got := creds.allows(&tc.info); got != tc.want {
+			t.Errorf("%v: allows() = %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+
+	creds = Credentials{Room: "room"}
+	if creds.allows(&message.AuthInfo{Host: true}) {
+		t.Errorf("allows() let a host in without a host passcode configured")
+	}
+	if creds.allows(&message.AuthInfo{Spectator: true}) {
+		t.Errorf("allows() let a spectator in without the room passcode")
+	}
+	if !creds.allows(&message.AuthInfo{ServerPasscode: "room"}) {
+		t.Errorf("allows() rejected a player with the room passcode")
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/baconstrip/kiken/message"
+)
+
+const (
+	// defaultHeartbeatInterval is how often clients are sent heartbeats,
+	// unless set otherwise with SetHeartbeat.
+	defaultHeartbeatInterval = 5 * time.Second
+	// defaultHeartbeatTimeout is how long a client that answers heartbeats
+	// can go without being heard from before it's dropped, unless set
+	// otherwise with SetHeartbeat.
+	defaultHeartbeatTimeout = 30 * time.Second
+)
+
+// heartbeat tracks whether a client is still answering heartbeats, and how
+// long they take to come back.
+type heartbeat struct {
+	mu sync.Mutex
+	// seq and sentAt are the sequence number and send time of the last
+	// heartbeat.
+	seq    int
+	sentAt time.Time
+	// lastHeard is when the last message of any kind came from the client.
+	lastHeard time.Time
+	// answers is whether the client has ever answered a heartbeat. Clients
+	// that don't are assumed not to support them, and are never timed out,
+	// since they may only send anything when their user does.
+	answers bool
+	rtt     time.Duration
+}
+
+// next records that a heartbeat is being sent, and returns its sequence
+// number.
+func (h *heartbeat) next(now time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	h.sentAt = now
+	return h.seq
+}
+
+// heard records that a message came from the client.
+func (h *heartbeat) heard(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastHeard = now
+}
+
+// ack records the client answering the heartbeat numbered seq. Only answers to
+// the latest heartbeat are timed, since older ones can't be told apart.
+func (h *heartbeat) ack(seq int, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.answers = true
+	if seq == h.seq {
+		h.rtt = now.Sub(h.sentAt)
+	}
+}
+
+// dead returns whether a client that answers heartbeats hasn't been heard from
+// for longer than timeout.
+func (h *heartbeat) dead(now time.Time, timeout time.Duration) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.answers && now.Sub(h.lastHeard) > timeout
+}
+
+// latency returns the last round trip time measured, and false if there
+// hasn't been one.
+func (h *heartbeat) latency() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.rtt, h.answers
+}
+
+// SetHeartbeat sets how often clients are sent heartbeats, and how long a
+// client that answers them can go without being heard from before it's
+// dropped. An interval of zero stops heartbeats being sent, and a timeout of
+// zero never drops clients. It only affects connections made, and servers
+// started, after it's called.
+func (s *Server) SetHeartbeat(interval, timeout time.Duration) {
+	s.heartbeatInterval = interval
+	s.heartbeatTimeout = timeout
+}
+
+// clientHeartbeat sends heartbeats to a connection until it's closed, closing
+// its socket if the client stops answering them. Closing the socket makes the
+// reader fail, which drops the client like any other failed connection.
+func (s *Server) clientHeartbeat(sid SessionID, conn *Connection) {
+	if s.heartbeatInterval <= 0 {
+		return
+	}
+	conn.hb.heard(time.Now())
+
+	ticker := time.NewTicker(s.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-conn.ctx.Done():
+			return
+		case now := <-ticker.C:
+			if s.heartbeatTimeout > 0 && conn.hb.dead(now, s.heartbeatTimeout) {
+				log.Printf("Closing connection to client with session %v, no heartbeat for %v", sid, s.heartbeatTimeout)
+				conn.soc.Close()
+				return
+			}
+			// The connection's queue is closed under the session lock when
+			// it's dropped, so it's only safe to queue on while holding it.
+			err := s.sessionManager.withConnection(sid, func(c *Connection) error {
+				if c != conn {
+					return fmt.Errorf("connection was replaced")
+				}
+				c.queue(EncodeServerMessage(&message.Heartbeat{Seq: c.hb.next(now)}))
+				return nil
+			})
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// reportLatencies sends each room's hosts the latency of its clients every
+// heartbeat interval, until the server shuts down.
+func (s *Server) reportLatencies() {
+	if s.heartbeatInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.roomsMu.RLock()
+			for code := range s.rooms {
+				latencies := s.sessionManager.latencies(code)
+				if len(latencies) == 0 {
+					continue
+				}
+				s.sessionManager.messageHost(code, EncodeServerMessage(&message.PlayerLatency{Latencies: latencies}))
+			}
+			s.roomsMu.RUnlock()
+		}
+	}
+}
+
+// latencies returns the round trip time, in milliseconds, of every connected
+// client in a room that answers heartbeats, by name.
+func (s *SessionManager) latencies(room string) map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	latencies := make(map[string]int)
+	for id, c := range s.connections {
+		vars, ok := s.sessions[id]
+		if !ok || vars.room != room {
+			continue
+		}
+		if rtt, ok := c.hb.latency(); ok {
+			latencies[vars.name] = int(rtt.Milliseconds())
+		}
+	}
+	return latencies
+}
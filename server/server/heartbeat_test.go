@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestHeartbeatDead(t *testing.T) {
+	start := time.Now()
+	var h heartbeat
+	h.heard(start)
+
+	// Clients that never answer are assumed not to support heartbeats.
+	if h.dead(start.Add(time.Hour), time.Minute) {
+		t.Errorf("dead() = true for a client that never answered, want false")
+	}
+
+	seq := h.next(start)
+	h.heard(start.Add(40 * time.Millisecond))
+	h.ack(seq, start.Add(40*time.Millisecond))
+	if rtt, ok := h.latency(); !ok || rtt != 40*time.Millisecond {
+		t.Errorf("latency() = %v, %v, want 40ms, true", rtt, ok)
+	}
+
+	// An answer to an earlier heartbeat doesn't change the latency.
+	h.next(start.Add(time.Second))
+	h.heard(start.Add(2 * time.Second))
+	h.ack(seq, start.Add(2*time.Second))
+	if rtt, _ := h.latency(); rtt != 40*time.Millisecond {
+		t.Errorf("latency() after a stale answer = %v, want 40ms", rtt)
+	}
+
+	if h.dead(start.Add(61*time.Second), time.Minute) {
+		t.Errorf("dead() = true within the timeout of the last answer, want false")
+	}
+	if !h.dead(start.Add(2*time.Minute), time.Minute) {
+		t.Errorf("dead() = false after the timeout, want true")
+	}
+}
+
+func TestSilentClientDropped(t *testing.T) {
+	for _, answer := range []bool{true, false} {
+		t.Run(fmt.Sprintf("answered=%v", answer), func(t *testing.T) {
+			testSilentClientDropped(t, answer)
+		})
+	}
+}
+
+// testSilentClientDropped checks a client that goes quiet is dropped if it
+// answered the first heartbeat before it did, and is left alone if it never
+// answers them, as clients without heartbeat support don't.
+func testSilentClientDropped(t *testing.T, answer bool) {
+	s := New("", Credentials{}, 0, NewListenerManager())
+	s.SetHeartbeat(10*time.Millisecond, 50*time.Millisecond)
+	room, err := s.CreateRoom(DefaultRoom)
+	if err != nil {
+		t.Fatalf("CreateRoom() failed: %v", err)
+	}
+	left := make(chan string, 1)
+	room.GlobalListeners().RegisterLeave(func(name string, host bool, spectator bool) error {
+		left <- name
+		return nil
+	})
+	srv := httptest.NewServer(s.mux)
+	defer srv.Close()
+	defer s.cancel()
+
+	ws := connectTestClients(t, s, srv, room.Code(), 1)[0]
+	defer ws.Close()
+
+	var msg struct {
+		Type string
+		Data struct{ Seq int }
+	}
+	for msg.Type != "Heartbeat" {
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatalf("Receive() failed: %v", err)
+		}
+	}
+	if answer {
+		ack := fmt.Sprintf(`{"Type": "HeartbeatAck", "Data": {"Seq": %v}}`, msg.Data.Seq)
+		if err := websocket.Message.Send(ws, ack); err != nil {
+			t.Fatalf("Send() failed: %v", err)
+		}
+	}
+
+	if !answer {
+		select {
+		case name := <-left:
+			t.Errorf("%v was dropped without ever answering a heartbeat", name)
+		case <-time.After(200 * time.Millisecond):
+		}
+		return
+	}
+	select {
+	case name := <-left:
+		if name != "player0" {
+			t.Errorf("leave listener called for %v, want player0", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("client that went quiet was never dropped")
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// freeAuthFailures is how many times a client may fail to authenticate
+	// before it has to wait between attempts.
+	freeAuthFailures = 5
+	// authBackoffBase is how long a client waits after its first failure past
+	// freeAuthFailures. The wait doubles with each further failure.
+	authBackoffBase = time.Second
+	// authBackoffMax is the longest a client has to wait between attempts.
+	authBackoffMax = 5 * time.Minute
+	// authFailureMemory is how long after its last failure a client's
+	// failures are forgotten.
+	authFailureMemory = 15 * time.Minute
+)
+
+// authAttempts tracks the failed authentication attempts by one client, or
+// against one name.
+type authAttempts struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// authLimiter slows down guessing of passcodes, by making clients wait longer
+// after each failed attempt. Attempts are tracked by keys, which identify both
+// where they come from and which name they're for.
+type authLimiter struct {
+	mu sync.Mutex
+
+	attempts map[string]*authAttempts
+	now      func() time.Time
+}
+
+func newAuthLimiter() *authLimiter {
+	return &authLimiter{
+		attempts: make(map[string]*authAttempts),
+		now:      time.Now,
+	}
+}
+
+// ipKey and nameKey build the keys attempts are tracked by.
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func nameKey(room, name string) string {
+	return "name:" + room + "/" + name
+}
+
+// wait returns how long until another attempt is allowed for all of keys, or
+// zero if it's allowed now.
+func (l *authLimiter) wait(keys ...string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var longest time.Duration
+	for _, k := range keys {
+		a, ok := l.attempts[k]
+		if !ok {
+			continue
+		}
+		if now.Sub(a.lastFailure) >= authFailureMemory {
+			delete(l.attempts, k)
+			continue
+		}
+		if w := a.blockedUntil.Sub(now); w > longest {
+			longest = w
+		}
+	}
+	return longest
+}
+
+// fail records a failed attempt for each of keys.
+func (l *authLimiter) fail(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for _, k := range keys {
+		a, ok := l.attempts[k]
+		if !ok || now.Sub(a.lastFailure) >= authFailureMemory {
+			a = &authAttempts{}
+			l.attempts[k] = a
+		}
+		a.failures++
+		a.lastFailure = now
+
+		if a.failures < freeAuthFailures {
+			continue
+		}
+		backoff := authBackoffMax
+		if shift := a.failures - freeAuthFailures; shift < 20 {
+			if d := authBackoffBase << shift; d < authBackoffMax {
+				backoff = d
+			}
+		}
+		a.blockedUntil = now.Add(backoff)
+	}
+}
+
+// succeed forgets the failed attempts for each of keys.
+func (l *authLimiter) succeed(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, k := range keys {
+		delete(l.attempts, k)
+	}
+}
+
+// reap forgets clients that haven't failed recently.
+func (l *authLimiter) reap() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for k, a := range l.attempts {
+		if now.Sub(a.lastFailure) >= authFailureMemory {
+			delete(l.attempts, k)
+		}
+	}
+}
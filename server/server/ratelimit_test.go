@@ -0,0 +1,58 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuthLimiterBackoff(t *testing.T) {
+	now := time.Now()
+	l := newAuthLimiter()
+	l.now = func() time.Time { return now }
+
+	ip, name := ipKey("192.0.2.1"), nameKey("alpha", "player")
+	for i := 0; i < freeAuthFailures-1; i++ {
+		l.fail(ip, name)
+		if w := l.wait(ip, name); w != 0 {
+			t.Fatalf("wait() after %v failures = %v, want 0", i+1, w)
+		}
+	}
+
+	l.fail(ip, name)
+	if w := l.wait(ip, name); w != authBackoffBase {
+		t.Errorf("wait() after %v failures = %v, want %v", freeAuthFailures, w, authBackoffBase)
+	}
+	l.fail(ip, name)
+	if w := l.wait(ip, name); w != 2*authBackoffBase {
+		t.Errorf("wait() after %v failures = %v, want %v", freeAuthFailures+1, w, 2*authBackoffBase)
+	}
+	if w := l.wait(ipKey("192.0.2.2")); w != 0 {
+		t.Errorf("wait() for another address = %v, want 0", w)
+	}
+
+	for i := 0; i < 30; i++ {
+		l.fail(ip)
+	}
+	if w := l.wait(ip); w != authBackoffMax {
+		t.Errorf("wait() after many failures = %v, want %v", w, authBackoffMax)
+	}
+
+	// Succeeding for a name doesn't let the address keep guessing.
+	l.succeed(name)
+	if w := l.wait(name); w != 0 {
+		t.Errorf("wait() for name after success = %v, want 0", w)
+	}
+	if w := l.wait(ip, name); w == 0 {
+		t.Errorf("wait() for address after success of a name = 0, want it to still wait")
+	}
+
+	now = now.Add(authFailureMemory)
+	if w := l.wait(ip); w != 0 {
+		t.Errorf("wait() once failures are forgotten = %v, want 0", w)
+	}
+	l.fail(ip)
+	l.reap()
+	if len(l.attempts) != 1 {
+		t.Errorf("reap() left %v clients, want 1", len(l.attempts))
+	}
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/util"
+)
+
+// DefaultRoom is the code of the room clients join when they don't ask for a
+// specific one.
+const DefaultRoom = "default"
+
+// RoomInitializer is called when a room is created, to attach whatever plays
+// the game in it to the room's listeners.
+type RoomInitializer func(r *Room)
+
+// Room is a group of players, spectators, and a host playing a game together.
+// Each room has its own listeners, and messages sent through a room only reach
+// the clients that joined it.
+type Room struct {
+	code   string
+	server *Server
+
+	globalListenerManager *ListenerManager
+	gameListenerManager   *ListenerManager
+
+	bansMu sync.RWMutex
+	// bannedNames and bannedAddrs hold the lowercased names and the addresses
+	// that can't join the room.
+	bannedNames map[string]bool
+	bannedAddrs map[string]bool
+
+	shutdownMu    sync.Mutex
+	shutdownHooks []func()
+}
+
+// Code returns the code clients use to join the room.
+func (r *Room) Code() string {
+	return r.code
+}
+
+// GlobalListeners returns the ListenerManager for listeners that last as long
+// as the room does.
+func (r *Room) GlobalListeners() *ListenerManager {
+	return r.globalListenerManager
+}
+
+// GameListeners returns the ListenerManager for listeners that last as long as
+// a single game in the room.
+func (r *Room) GameListeners() *ListenerManager {
+	return r.gameListenerManager
+}
+
+// MessageAll schedules a message to be sent to all clients in the room
+// asynchronously. msg should not be modified after calling this function.
+func (r *Room) MessageAll(msg message.ServerMessage) {
+	r.server.sessionManager.messageAll(r.code, msg)
+}
+
+// MessageHost schedules a message to be sent to the host client of the room
+// asynchronously. msg should not be modified after calling this function.
+func (r *Room) MessageHost(msg message.ServerMessage) {
+	r.server.sessionManager.messageHost(r.code, msg)
+}
+
+// MessagePlayers schedules a message to be sent to all player clients in the
+// room asynchronously. msg should not be modified after calling this function.
+func (r *Room) MessagePlayers(msg message.ServerMessage) {
+	r.server.sessionManager.messagePlayers(r.code, msg)
+}
+
+// MessagePlayer schedules a message to be sent to the client in the room named
+// by name asynchronously. msg should not be modified after calling this
+// function.
+func (r *Room) MessagePlayer(msg message.ServerMessage, name string) {
+	r.server.sessionManager.messagePlayer(r.code, msg, name)
+}
+
+// RevokeSession ends every session of the named client in the room,
+// disconnecting them. They must sign in again to rejoin. Returns false if
+// nobody in the room has that name.
+func (r *Room) RevokeSession(name string) bool {
+	return r.endSessions(name, EncodeServerMessage(&message.SessionRevoked{}))
+}
+
+// Kick ends every session of the named client in the room, disconnecting them,
+// like RevokeSession. Returns false if nobody in the room has that name.
+func (r *Room) Kick(name string) bool {
+	return r.endSessions(name, EncodeServerMessage(&message.Kicked{}))
+}
+
+// endSessions ends every session of the named client in the room, sending
+// them notice first. Returns false if nobody in the room has that name.
+func (r *Room) endSessions(name string, notice message.ServerMessage) bool {
+	ids := r.server.sessionManager.IDsFromName(r.code, name)
+	for _, id := range ids {
+		r.server.endSession(id, notice)
+	}
+	return len(ids) > 0
+}
+
+// Ban kicks the named client from the room, and stops anyone from joining
+// the room with that name until ClearBans is called. If banAddr is set, the
+// address the client signed in from is banned as well. Returns false if
+// nobody in the room has that name.
+func (r *Room) Ban(name string, banAddr bool) bool {
+	ids := r.server.sessionManager.IDsFromName(r.code, name)
+	if len(ids) == 0 {
+		return false
+	}
+
+	r.bansMu.Lock()
+	r.bannedNames[strings.ToLower(name)] = true
+	if banAddr {
+		for _, id := range ids {
+			if vars, ok := r.server.sessionManager.get(id); ok && vars.addr != "" {
+				r.bannedAddrs[vars.addr] = true
+			}
+		}
+	}
+	r.bansMu.Unlock()
+
+	return r.endSessions(name, EncodeServerMessage(&message.Kicked{Banned: true}))
+}
+
+// ClearBans lets everyone who was banned from the room join it again.
+func (r *Room) ClearBans() {
+	r.bansMu.Lock()
+	defer r.bansMu.Unlock()
+	r.bannedNames = make(map[string]bool)
+	r.bannedAddrs = make(map[string]bool)
+}
+
+// banned returns whether a client with the given name and address is banned
+// from the room.
+func (r *Room) banned(name, addr string) bool {
+	r.bansMu.RLock()
+	defer r.bansMu.RUnlock()
+	return r.bannedNames[strings.ToLower(name)] || r.bannedAddrs[addr]
+}
+
+// OnShutdown registers f to be called when the server shuts down, after
+// clients are told and before their connections are closed.
+func (r *Room) OnShutdown(f func()) {
+	r.shutdownMu.Lock()
+	defer r.shutdownMu.Unlock()
+	r.shutdownHooks = append(r.shutdownHooks, f)
+}
+
+// shutdown runs the room's shutdown hooks.
+func (r *Room) shutdown() {
+	r.shutdownMu.Lock()
+	defer r.shutdownMu.Unlock()
+	for _, f := range r.shutdownHooks {
+		f()
+	}
+}
+
+// normalizeRoomCode returns the canonical form of a room code given by a
+// client, using the default room if none was given.
+func normalizeRoomCode(code string) (string, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultRoom, nil
+	}
+	if !util.IsValidRoomCode(code) {
+		return "", fmt.Errorf("invalid room code: %q", code)
+	}
+	return code, nil
+}
+
+// room returns the room with the given code, if it exists.
+func (s *Server) room(code string) (*Room, bool) {
+	s.roomsMu.RLock()
+	defer s.roomsMu.RUnlock()
+	r, ok := s.rooms[code]
+	return r, ok
+}
+
+// SetRoomInitializer sets the function called for every room created
+// afterwards. It should be set before any rooms are created.
+func (s *Server) SetRoomInitializer(init RoomInitializer) {
+	s.roomsMu.Lock()
+	defer s.roomsMu.Unlock()
+	s.roomInit = init
+}
+
+// CreateRoom creates the room with the given code and runs the room
+// initializer on it. If the room already exists, it is returned unchanged.
+func (s *Server) CreateRoom(code string) (*Room, error) {
+	code, err := normalizeRoomCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	s.roomsMu.Lock()
+	defer s.roomsMu.Unlock()
+
+	if r, ok := s.rooms[code]; ok {
+		return r, nil
+	}
+
+	r := &Room{
+		code:                  code,
+		server:                s,
+		globalListenerManager: NewListenerManager(),
+		gameListenerManager:   NewListenerManager(),
+		bannedNames:           make(map[string]bool),
+		bannedAddrs:           make(map[string]bool),
+	}
+	// The initializer runs with the lock held so that no client can join the
+	// room before its listeners are registered.
+	if s.roomInit != nil {
+		s.roomInit(r)
+	}
+	s.rooms[code] = r
+
+	log.Printf("Created room %v", code)
+	return r, nil
+}
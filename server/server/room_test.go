@@ -0,0 +1,169 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baconstrip/kiken/message"
+	"golang.org/x/net/websocket"
+)
+
+// signIn signs in to s as the player name with passcode, and returns the
+// session cookie it's given.
+func signIn(t *testing.T, s *Server, room, name, passcode string) *http.Cookie {
+	t.Helper()
+
+	form := url.Values{
+		"Name":     {name},
+		"Passcode": {passcode},
+		"Room":     {room},
+		"Host":     {"false"},
+		"Editor":   {"false"},
+		"Spectate": {"false"},
+	}
+	r := httptest.NewRequest("POST", "/api/auth", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.authHandler(w, r)
+
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionName {
+			return c
+		}
+	}
+	t.Fatalf("signing in as %v failed: %v", name, w.Body.String())
+	return nil
+}
+
+// authenticated returns whether a request made with cookie is signed in.
+func authenticated(s *Server, cookie *http.Cookie) bool {
+	r := httptest.NewRequest("GET", "/ws/game", nil)
+	r.AddCookie(cookie)
+	_, _, err := s.verifyAuthenticated(r)
+	return err == nil
+}
+
+func TestKickEndsEarlierSessions(t *testing.T) {
+	s := New("", Credentials{}, 0, NewListenerManager())
+	room, err := s.CreateRoom(DefaultRoom)
+	if err != nil {
+		t.Fatalf("CreateRoom() failed: %v", err)
+	}
+
+	first := signIn(t, s, room.Code(), "player", "secret")
+	// Names are matched without case when rejoining.
+	second := signIn(t, s, room.Code(), "Player", "secret")
+	if authenticated(s, first) {
+		t.Errorf("session from before rejoining is still signed in")
+	}
+	if !authenticated(s, second) {
+		t.Fatalf("session from rejoining isn't signed in")
+	}
+
+	if !room.Kick("player") {
+		t.Fatalf("Kick() found nobody to kick")
+	}
+	for i, c := range []*http.Cookie{first, second} {
+		if authenticated(s, c) {
+			t.Errorf("session %v is still signed in after being kicked", i)
+		}
+	}
+	if room.Kick("player") {
+		t.Errorf("Kick() found someone to kick after they were kicked")
+	}
+}
+
+// receiveNames returns the names in the HostAdd messages ws receives, up to
+// and including one naming "done". Other messages are skipped.
+func receiveNames(t *testing.T, ws *websocket.Conn) []string {
+	t.Helper()
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var names []string
+	for {
+		var msg struct {
+			Type string
+			Data struct{ Name string }
+		}
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatalf("Receive() failed after %v: %v", names, err)
+		}
+		if msg.Type != "HostAdd" {
+			continue
+		}
+		names = append(names, msg.Data.Name)
+		if msg.Data.Name == "done" {
+			return names
+		}
+	}
+}
+
+func TestRoomsAreIsolated(t *testing.T) {
+	s := New("", Credentials{}, 0, NewListenerManager())
+	first, err := s.CreateRoom("first")
+	if err != nil {
+		t.Fatalf("CreateRoom() failed: %v", err)
+	}
+	second, err := s.CreateRoom("second")
+	if err != nil {
+		t.Fatalf("CreateRoom() failed: %v", err)
+	}
+	srv := httptest.NewServer(s.mux)
+	defer srv.Close()
+	defer s.cancel()
+
+	// Both rooms have players with the same names, who must each have their
+	// own session.
+	firstClients := connectTestClients(t, s, srv, first.Code(), 2)
+	secondClients := connectTestClients(t, s, srv, second.Code(), 2)
+	for _, ws := range append(firstClients, secondClients...) {
+		defer ws.Close()
+	}
+	firstIDs := s.sessionManager.IDsFromName(first.Code(), "player0")
+	secondIDs := s.sessionManager.IDsFromName(second.Code(), "player0")
+	if len(firstIDs) != 1 || len(secondIDs) != 1 || firstIDs[0] == secondIDs[0] {
+		t.Fatalf("sessions for player0 in each room = %v and %v, want one each, different", firstIDs, secondIDs)
+	}
+
+	// player0 hosts each room.
+	s.sessionManager.mu.Lock()
+	for id, vars := range s.sessionManager.sessions {
+		if vars.name == "player0" {
+			vars.host = true
+			s.sessionManager.sessions[id] = vars
+		}
+	}
+	s.sessionManager.mu.Unlock()
+
+	named := func(name string) message.ServerMessage {
+		return EncodeServerMessage(&message.HostAdd{Name: name})
+	}
+	first.MessageAll(named("first all"))
+	first.MessageHost(named("first host"))
+	first.MessagePlayers(named("first players"))
+	first.MessagePlayer(named("first player1"), "player1")
+	second.MessagePlayer(named("second player0"), "player0")
+	first.MessageAll(named("done"))
+	second.MessageAll(named("done"))
+
+	tests := []struct {
+		name string
+		ws   *websocket.Conn
+		want []string
+	}{
+		{"first host", firstClients[0], []string{"first all", "first host", "done"}},
+		{"first player", firstClients[1], []string{"first all", "first players", "first player1", "done"}},
+		{"second host", secondClients[0], []string{"second player0", "done"}},
+		{"second player", secondClients[1], []string{"done"}},
+	}
+	for _, test := range tests {
+		if got := receiveNames(t, test.ws); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v received %q, want %q", test.name, got, test.want)
+		}
+	}
+}
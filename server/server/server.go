@@ -2,13 +2,18 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/baconstrip/kiken/message"
@@ -19,6 +24,12 @@ import (
 const (
 	sessionName        = "_SESSION"
 	maxUint64   uint64 = 18446744073709551615
+
+	// reapInterval is how often expired sessions are removed.
+	reapInterval = 10 * time.Minute
+	// noticeTimeout is how long sending a notice to a client that's about to
+	// be disconnected may take, so a stalled client can't hold things up.
+	noticeTimeout = 2 * time.Second
 )
 
 type Server struct {
@@ -26,16 +37,39 @@ type Server struct {
 
 	sessionManager SessionManager
 
-	globalListenerManager *ListenerManager
-	gameListenerManager   *ListenerManager
 	editorListenerMangaer *ListenerManager
 
-	mux      *http.ServeMux
-	port     int
-	passcode string
+	roomsMu  sync.RWMutex
+	rooms    map[string]*Room
+	roomInit RoomInitializer
+
+	mux         *http.ServeMux
+	httpServer  *http.Server
+	port        int
+	credentials Credentials
+
+	authLimiter *authLimiter
+	tokens      *tokenSigner
+
+	// heartbeatInterval and heartbeatTimeout are set by SetHeartbeat.
+	heartbeatInterval time.Duration
+	heartbeatTimeout  time.Duration
+
+	// ctx is done once the server starts shutting down. Every connection's
+	// context is derived from it.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// connWg counts the connections still being served.
+	connWg sync.WaitGroup
 }
 
+// verifyAuthenticated returns the session a request was made in, identified by
+// either a token or the session cookie.
 func (s *Server) verifyAuthenticated(r *http.Request) (SessionID, SessionVar, error) {
+	if token := requestToken(r); token != "" {
+		return s.verifyToken(token)
+	}
+
 	sessionCookie, err := r.Cookie(sessionName)
 	if err != nil {
 		return 0, SessionVar{}, err
@@ -46,99 +80,115 @@ func (s *Server) verifyAuthenticated(r *http.Request) (SessionID, SessionVar, er
 		return 0, SessionVar{}, err
 	}
 
-	s.sessionManager.mu.RLock()
-	defer s.sessionManager.mu.RUnlock()
-	vars, ok := s.sessionManager.sessions[SessionID(session)]
+	vars, ok := s.sessionManager.lookup(SessionID(session))
 	if !ok {
-		vars, ok := s.sessionManager.editorSessions[SessionID(session)]
-		if !ok {
-			return 0, SessionVar{}, fmt.Errorf("user not authenticated")
-		}
-		return SessionID(session), vars, nil
+		return 0, SessionVar{}, fmt.Errorf("user not authenticated")
 	}
 
 	return SessionID(session), vars, nil
 }
 
-func (s *Server) clientWriter(sid SessionID) {
+// verifyToken returns the session a token was issued for, from the token's
+// signature and claims alone, without looking the session up. Sessions that are
+// destroyed before they expire are revoked, so that their tokens are refused.
+func (s *Server) verifyToken(token string) (SessionID, SessionVar, error) {
+	claims, err := s.tokens.verify(token, time.Now())
+	if err != nil {
+		return 0, SessionVar{}, err
+	}
+	if s.sessionManager.isRevoked(claims.ID) {
+		return 0, SessionVar{}, fmt.Errorf("token revoked")
+	}
+	return claims.ID, claims.vars(), nil
+}
+
+// listenersFor returns the ListenerManagers that events from a session are
+// dispatched to: the editor's for editors, and the session's room's for
+// everyone else.
+func (s *Server) listenersFor(vars SessionVar) []*ListenerManager {
+	if vars.editor {
+		return []*ListenerManager{s.editorListenerMangaer}
+	}
+	r, ok := s.room(vars.room)
+	if !ok {
+		return nil
+	}
+	return []*ListenerManager{r.globalListenerManager, r.gameListenerManager}
+}
+
+// sendNow sends a message over a connection's socket immediately, rather than
+// scheduling it.
+func sendNow(c *Connection, msg message.ServerMessage) error {
+	out, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error encoding messsage for client: %v", err)
+	}
+	return websocket.Message.Send(c.soc, string(out))
+}
+
+// sendNotice sends a message over a connection's socket immediately, giving up
+// at deadline. It's for telling a client why it's about to be disconnected, as
+// the deadline stays set on the socket afterwards.
+func sendNotice(c *Connection, msg message.ServerMessage, deadline time.Time) error {
+	if err := c.soc.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	return sendNow(c, msg)
+}
+
+// clientWriter sends the messages queued for a connection as soon as they're
+// queued, until the connection is closed.
+func (s *Server) clientWriter(sid SessionID, conn *Connection) {
 	for {
-		err := s.sessionManager.withConnection(sid, func(c *Connection) error {
-			select {
-			case msg := <-c.out:
+		select {
+		case <-conn.ctx.Done():
+			return
+		case msg, ok := <-conn.out:
+			if !ok {
+				return
+			}
+			// Heartbeats and latency reports are too frequent to be worth
+			// logging.
+			if msg.Type != "Heartbeat" && msg.Type != "PlayerLatency" {
 				log.Printf("Sending message to client with type %v \n\t\t%+v", msg.Type, msg.Data)
-				out, err := json.Marshal(msg)
-				if err != nil {
-					log.Printf("Error encoding messsage for client: %v", err)
-				}
-				if err := websocket.Message.Send(c.soc, string(out)); err != nil {
-					go func() {
-						name, firstLeave, host := s.sessionManager.dropConnection(sid)
-
-						s.sessionManager.mu.RLock()
-						vars, ok := s.sessionManager.sessions[sid]
-						if !ok {
-							s.sessionManager.mu.RUnlock()
-							return
-						}
-						s.sessionManager.mu.RUnlock()
-
-						if firstLeave {
-							if !vars.editor {
-								s.globalListenerManager.dispatchLeave(name, host, vars.spectator)
-								s.gameListenerManager.dispatchLeave(name, host, vars.spectator)
-							} else {
-								s.editorListenerMangaer.dispatchLeave(name, false, vars.spectator)
-							}
-						}
-					}()
-					log.Printf("Dropping connection to client with session %v because of error sending message: %v", sid, err)
-					return err
-				}
-			default:
 			}
-			return nil
-		})
-		if err != nil {
-			log.Printf("Dropped connection to %v", sid)
-			return
+			if err := sendNow(conn, msg); err != nil {
+				log.Printf("Dropping connection to client with session %v because of error sending message: %v", sid, err)
+				s.dropClient(sid, conn)
+				return
+			}
 		}
-		time.Sleep(10 * time.Millisecond)
 	}
 }
 
-func (s *Server) clientReader(sid SessionID, ws *websocket.Conn) {
+func (s *Server) clientReader(sid SessionID, conn *Connection) {
 	for {
 		var msg []byte
-		err := websocket.Message.Receive(ws, &msg)
+		err := websocket.Message.Receive(conn.soc, &msg)
 		if err != nil {
-			log.Printf("Dropping connection to client with session %v because of error reading input: %v", sid, err)
-			name, firstLeave, host := s.sessionManager.dropConnection(sid)
-
-			s.sessionManager.mu.RLock()
-			vars, ok := s.sessionManager.sessions[sid]
-			if !ok {
-				s.sessionManager.mu.RUnlock()
-				return
-			}
-			s.sessionManager.mu.RUnlock()
-
-			if firstLeave {
-				if !vars.editor {
-					s.globalListenerManager.dispatchLeave(name, host, vars.spectator)
-					s.gameListenerManager.dispatchLeave(name, host, vars.spectator)
-				} else {
-					s.editorListenerMangaer.dispatchLeave(name, false, vars.spectator)
-				}
+			if conn.ctx.Err() == nil {
+				log.Printf("Dropping connection to client with session %v because of error reading input: %v", sid, err)
 			}
+			s.dropClient(sid, conn)
 			return
 		}
 
+		conn.hb.heard(time.Now())
+
 		m, err := decodeClientMessage(msg)
 		if err != nil {
 			log.Printf("Bad message from client %v, error: %v", sid, err)
 			continue
 		}
+		// Heartbeats are answered to the server itself, not the listeners.
+		if ack, ok := m.Data.(*message.HeartbeatAck); ok {
+			conn.hb.ack(ack.Seq, time.Now())
+			continue
+		}
 		err = s.sessionManager.withConnection(sid, func(c *Connection) error {
+			if c != conn {
+				return fmt.Errorf("connection was replaced")
+			}
 			c.in <- m
 			return nil
 		})
@@ -147,46 +197,78 @@ func (s *Server) clientReader(sid SessionID, ws *websocket.Conn) {
 		if err != nil {
 			return
 		}
-
-		time.Sleep(10 * time.Millisecond)
 	}
 }
 
-func (s *Server) clientDispatcher(sid SessionID) {
-	for {
-		// Obtain the name and a fresh reference to the input channel.
-		s.sessionManager.mu.RLock()
+// dropClient drops a connection that failed, and tells the listeners the
+// client left. Connections that were already closed on purpose, or replaced by
+// a newer connection, are left alone.
+func (s *Server) dropClient(sid SessionID, conn *Connection) {
+	if conn.ctx.Err() != nil {
+		return
+	}
+	_, firstLeave, host, ok := s.sessionManager.dropConnection(sid, conn)
+	if !ok {
+		return
+	}
 
-		vars, ok := s.sessionManager.sessions[sid]
-		if !ok {
-			s.sessionManager.mu.RUnlock()
-			return
+	vars, ok := s.sessionManager.get(sid)
+	if !ok {
+		return
+	}
+
+	if firstLeave {
+		for _, lm := range s.listenersFor(vars) {
+			lm.dispatchLeave(vars.name, host, vars.spectator)
 		}
-		conn, ok := s.sessionManager.connections[sid]
+	}
+}
+
+func (s *Server) clientDispatcher(sid SessionID, conn *Connection) {
+	for {
+		// Obtain the name, to check the session still exists.
+		vars, ok := s.sessionManager.get(sid)
 		if !ok {
-			s.sessionManager.mu.RUnlock()
 			return
 		}
-		inChan := conn.in
-		s.sessionManager.mu.RUnlock()
 
 		// Park until a message is available on the input channel, then
 		// propagate when a message is found. Alternatively, return if the
-		// channel is already closed.
-		if msg, ok := <-inChan; !ok {
-			log.Printf("leaving client dispatcher, channel is already closed.")
+		// channel is already closed or the connection is done.
+		select {
+		case <-conn.ctx.Done():
 			return
-		} else {
-			if !vars.editor {
-				s.globalListenerManager.dispatchMessage(vars.name, vars.host, msg)
-				s.gameListenerManager.dispatchMessage(vars.name, vars.host, msg)
-			} else {
-				s.editorListenerMangaer.dispatchMessage(vars.name, false, msg)
+		case msg, ok := <-conn.in:
+			if !ok {
+				log.Printf("leaving client dispatcher, channel is already closed.")
+				return
+			}
+			for _, lm := range s.listenersFor(vars) {
+				lm.dispatchMessage(vars.name, vars.host, msg)
 			}
 		}
 	}
 }
 
+// serveConnection starts the goroutines serving a client's connection, and
+// waits until the connection is dropped or the server shuts down. The socket
+// is closed once the websocket handler calling this returns.
+func (s *Server) serveConnection(sid SessionID, ws *websocket.Conn, join func()) {
+	s.connWg.Add(1)
+	defer s.connWg.Done()
+
+	conn := s.sessionManager.addConnection(s.ctx, sid, ws)
+
+	go s.clientWriter(sid, conn)
+	go s.clientReader(sid, conn)
+	go s.clientDispatcher(sid, conn)
+	go s.clientHeartbeat(sid, conn)
+
+	join()
+
+	<-conn.ctx.Done()
+}
+
 func (s *Server) editorInteractiveHandler(ws *websocket.Conn) {
 	sid, vars, err := s.verifyAuthenticated(ws.Request())
 	if err != nil {
@@ -200,18 +282,9 @@ func (s *Server) editorInteractiveHandler(ws *websocket.Conn) {
 		return
 	}
 
-	s.sessionManager.addConnection(sid, ws)
-
-	go s.clientWriter(sid)
-	go s.clientReader(sid, ws)
-	go s.clientDispatcher(sid)
-
-	s.editorListenerMangaer.dispatchJoin(vars.name, false, false)
-
-	// Wait forever
-	for {
-		time.Sleep(10 * time.Minute)
-	}
+	s.serveConnection(sid, ws, func() {
+		s.editorListenerMangaer.dispatchJoin(vars.name, false, false)
+	})
 }
 
 func (s *Server) playerInteractiveHandler(ws *websocket.Conn) {
@@ -229,21 +302,21 @@ func (s *Server) playerInteractiveHandler(ws *websocket.Conn) {
 		return
 	}
 
-	log.Printf("Session of authenticated client: %+v", vars)
-
-	s.sessionManager.addConnection(sid, ws)
+	// The session's passcode hash is left out, so that it can't be read from
+	// the logs.
+	log.Printf("Session of authenticated client: name %v, room %v, host %v, spectator %v, expires %v", vars.name, vars.room, vars.host, vars.spectator, vars.expires.Format(time.RFC3339))
 
-	go s.clientWriter(sid)
-	go s.clientReader(sid, ws)
-	go s.clientDispatcher(sid)
-
-	s.globalListenerManager.dispatchJoin(vars.name, vars.host, vars.spectator)
-	s.gameListenerManager.dispatchJoin(vars.name, vars.host, vars.spectator)
-
-	// Wait forever
-	for {
-		time.Sleep(10 * time.Minute)
+	room, ok := s.room(vars.room)
+	if !ok {
+		log.Printf("Client %v attempted to join room %v, which doesn't exist", vars.name, vars.room)
+		ws.Close()
+		return
 	}
+
+	s.serveConnection(sid, ws, func() {
+		room.globalListenerManager.dispatchJoin(vars.name, vars.host, vars.spectator)
+		room.gameListenerManager.dispatchJoin(vars.name, vars.host, vars.spectator)
+	})
 }
 
 func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
@@ -275,6 +348,15 @@ func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
 	http.ServeContent(w, r, r.URL.Path, info.ModTime(), f)
 }
 
+// clientIP returns the address a request came from, without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func writeError(w http.ResponseWriter, msg string, code int) {
 	m, err := json.Marshal(&message.ServerError{
 		Error: msg,
@@ -292,6 +374,16 @@ func writeJSON(w http.ResponseWriter, msg interface{}) {
 	e.Encode(msg)
 }
 
+// writeAuthSuccess tells a client that it signed in, along with the token for
+// its new session. Clients that can't get a token can still use the cookie.
+func (s *Server) writeAuthSuccess(w http.ResponseWriter, id SessionID, vars SessionVar, msg string) {
+	token, err := s.tokens.sign(id, vars)
+	if err != nil {
+		log.Printf("Failed to issue token for %v: %v", vars.name, err)
+	}
+	writeJSON(w, &message.AuthSuccess{Msg: msg, Token: token})
+}
+
 func (s *Server) authHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeError(w, "Bad request", 1001)
@@ -311,6 +403,7 @@ func (s *Server) authHandler(w http.ResponseWriter, r *http.Request) {
 	hostRaw := r.PostFormValue("Host")
 	editorRaw := r.PostFormValue("Editor")
 	spectatorRaw := r.PostFormValue("Spectate")
+	roomRaw := r.PostFormValue("Room")
 
 	host, err := strconv.ParseBool(hostRaw)
 	if err != nil {
@@ -328,6 +421,12 @@ func (s *Server) authHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	room, err := normalizeRoomCode(roomRaw)
+	if err != nil {
+		writeError(w, "Room codes may only contain letters, numbers, and dashes", 1094)
+		return
+	}
+
 	authInfo := &message.AuthInfo{
 		Name:           name,
 		ServerPasscode: serverPasscode,
@@ -335,6 +434,7 @@ func (s *Server) authHandler(w http.ResponseWriter, r *http.Request) {
 		Host:           host,
 		Editor:         editor,
 		Spectator:      spectator,
+		Room:           room,
 	}
 
 	// Various checks
@@ -352,13 +452,32 @@ func (s *Server) authHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Failed attempts are limited both by where they come from and the name
+	// they're for, so that guessing is slow even from many addresses.
+	attemptRoom := authInfo.Room
 	if authInfo.Editor {
-		if authInfo.ServerPasscode != s.passcode {
-			writeError(w, "Bad passcode", 1008)
-			return
-		}
+		attemptRoom = ""
+	}
+	addr := clientIP(r)
+	ipAttempts := ipKey(addr)
+	nameAttempts := nameKey(attemptRoom, strings.ToLower(authInfo.Name))
+	if wait := s.authLimiter.wait(ipAttempts, nameAttempts); wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		writeError(w, fmt.Sprintf("Too many failed attempts, try again in %v seconds", seconds), 1096)
+		return
+	}
 
-		err := s.sessionManager.createSession(SessionVar{
+	if !s.credentials.allows(authInfo) {
+		s.authLimiter.fail(ipAttempts, nameAttempts)
+		writeError(w, "Bad passcode", 1008)
+		return
+	}
+
+	if authInfo.Editor {
+		s.authLimiter.succeed(nameAttempts)
+
+		id, vars, err := s.sessionManager.createSession(SessionVar{
 			name:   authInfo.Name,
 			editor: true,
 		}, w)
@@ -369,26 +488,50 @@ func (s *Server) authHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		writeJSON(w, &message.AuthSuccess{Msg: "Successfully joined as editor"})
+		s.writeAuthSuccess(w, id, vars, "Successfully joined as editor")
 		return
 	}
 
-	if s.sessionManager.userExists(authInfo.Name, true) {
+	// Hosts open rooms, everyone else can only join rooms that are open.
+	if !authInfo.Host {
+		room, ok := s.room(authInfo.Room)
+		if !ok {
+			writeError(w, "No game is open with that room code", 1095)
+			return
+		}
+		if room.banned(authInfo.Name, addr) {
+			writeError(w, "You have been banned from this game", 1097)
+			return
+		}
+	}
+
+	if s.sessionManager.userExists(authInfo.Room, authInfo.Name, true) {
 		if !authInfo.Host {
-			if s.sessionManager.correctPasscode(authInfo.Name, true, passcode) {
-				err = s.sessionManager.createSession(SessionVar{
-					name:     authInfo.Name,
-					passcode: authInfo.Passcode,
-					host:     false,
-				}, w)
+			if s.sessionManager.correctPasscode(authInfo.Room, authInfo.Name, true, passcode) {
+				s.authLimiter.succeed(nameAttempts)
+				var id SessionID
+				var vars SessionVar
+				hash, err := util.HashPasscode(authInfo.Passcode)
+				if err == nil {
+					id, vars, err = s.sessionManager.createSession(SessionVar{
+						name:         authInfo.Name,
+						room:         authInfo.Room,
+						passcodeHash: hash,
+						host:         false,
+						spectator:    authInfo.Spectator,
+						addr:         addr,
+					}, w)
+				}
 				if err != nil {
 					log.Printf("Failed to create session for returning player: %v", err)
 					writeError(w, "Bad request", 1019)
+					return
 				}
 
-				writeJSON(w, &message.AuthSuccess{Msg: "Successfully rejoined as player"})
+				s.writeAuthSuccess(w, id, vars, "Successfully rejoined as player")
 				return
 			} else {
+				s.authLimiter.fail(ipAttempts, nameAttempts)
 				writeError(w, "Incorrect passcode", 1015)
 				return
 			}
@@ -396,13 +539,17 @@ func (s *Server) authHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if authInfo.Host {
-		if authInfo.ServerPasscode != s.passcode {
-			writeError(w, "Bad passcode", 1008)
+		s.authLimiter.succeed(nameAttempts)
+
+		if _, err := s.CreateRoom(authInfo.Room); err != nil {
+			writeError(w, "Bad request", 1009)
+			log.Printf("Failed to create room for host: %v", err)
 			return
 		}
 
-		err := s.sessionManager.createSession(SessionVar{
+		id, vars, err := s.sessionManager.createSession(SessionVar{
 			name: authInfo.Name,
+			room: authInfo.Room,
 			host: true,
 		}, w)
 		if err != nil {
@@ -410,7 +557,7 @@ func (s *Server) authHandler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Failed to create session for host: %v", err)
 			return
 		}
-		writeJSON(w, &message.AuthSuccess{Msg: "Successfully joined as host"})
+		s.writeAuthSuccess(w, id, vars, "Successfully joined as host")
 		return
 	}
 
@@ -419,12 +566,19 @@ func (s *Server) authHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.sessionManager.createSession(SessionVar{
-		name:      authInfo.Name,
-		passcode:  authInfo.Passcode,
-		host:      false,
-		spectator: authInfo.Spectator,
-	}, w)
+	var id SessionID
+	var vars SessionVar
+	hash, err := util.HashPasscode(authInfo.Passcode)
+	if err == nil {
+		id, vars, err = s.sessionManager.createSession(SessionVar{
+			name:         authInfo.Name,
+			room:         authInfo.Room,
+			passcodeHash: hash,
+			host:         false,
+			spectator:    authInfo.Spectator,
+			addr:         addr,
+		}, w)
+	}
 
 	if err != nil {
 		writeError(w, "Bad request", 1012)
@@ -432,7 +586,7 @@ func (s *Server) authHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, &message.AuthSuccess{Msg: "Successfully joined as player"})
+	s.writeAuthSuccess(w, id, vars, "Successfully joined as player")
 }
 
 func decodeClientMessage(msg []byte) (message.ClientMessage, error) {
@@ -491,10 +645,18 @@ func decodeClientMessage(msg []byte) (message.ClientMessage, error) {
 		m := message.AttemptAnswer{}
 		err = d.Decode(&m)
 		value = &m
+	case "HeartbeatAck":
+		m := message.HeartbeatAck{}
+		err = d.Decode(&m)
+		value = &m
 	case "MarkAnswer":
 		m := message.MarkAnswer{}
 		err = d.Decode(&m)
 		value = &m
+	case "MarkOwariAnswer":
+		m := message.MarkOwariAnswer{}
+		err = d.Decode(&m)
+		value = &m
 	case "EnterBid":
 		m := message.EnterBid{}
 		err = d.Decode(&m)
@@ -507,6 +669,28 @@ func decodeClientMessage(msg []byte) (message.ClientMessage, error) {
 		m := message.CancelGame{}
 		err = d.Decode(&m)
 		value = &m
+	case "Pause":
+		value = &message.Pause{}
+	case "Resume":
+		value = &message.Resume{}
+	case "ResetHistory":
+		value = &message.ResetHistory{}
+	case "RevokeSession":
+		m := message.RevokeSession{}
+		err = d.Decode(&m)
+		value = &m
+	case "TransferHost":
+		m := message.TransferHost{}
+		err = d.Decode(&m)
+		value = &m
+	case "KickPlayer":
+		m := message.KickPlayer{}
+		err = d.Decode(&m)
+		value = &m
+	case "BanPlayer":
+		m := message.BanPlayer{}
+		err = d.Decode(&m)
+		value = &m
 
 	// Editor messages
 	case "RequestShows":
@@ -519,6 +703,58 @@ func decodeClientMessage(msg []byte) (message.ClientMessage, error) {
 		m := message.AddCategory{}
 		err = d.Decode(&m)
 		value = &m
+	case "CreateShow":
+		m := message.CreateShow{}
+		err = d.Decode(&m)
+		value = &m
+	case "RenameShow":
+		m := message.RenameShow{}
+		err = d.Decode(&m)
+		value = &m
+	case "DuplicateShow":
+		m := message.DuplicateShow{}
+		err = d.Decode(&m)
+		value = &m
+	case "DeleteShow":
+		m := message.DeleteShow{}
+		err = d.Decode(&m)
+		value = &m
+	case "SetShowInfo":
+		m := message.SetShowInfo{}
+		err = d.Decode(&m)
+		value = &m
+	case "SetCategoryComment":
+		m := message.SetCategoryComment{}
+		err = d.Decode(&m)
+		value = &m
+	case "RenameCategory":
+		m := message.RenameCategory{}
+		err = d.Decode(&m)
+		value = &m
+	case "DeleteCategory":
+		m := message.DeleteCategory{}
+		err = d.Decode(&m)
+		value = &m
+	case "MoveCategory":
+		m := message.MoveCategory{}
+		err = d.Decode(&m)
+		value = &m
+	case "AddClue":
+		m := message.AddClue{}
+		err = d.Decode(&m)
+		value = &m
+	case "EditClue":
+		m := message.EditClue{}
+		err = d.Decode(&m)
+		value = &m
+	case "DeleteClue":
+		m := message.DeleteClue{}
+		err = d.Decode(&m)
+		value = &m
+	case "SetOwari":
+		m := message.SetOwari{}
+		err = d.Decode(&m)
+		value = &m
 	case "AdjustScore":
 		m := message.AdjustScore{}
 		err = d.Decode(&m)
@@ -533,7 +769,10 @@ func decodeClientMessage(msg []byte) (message.ClientMessage, error) {
 	if value == nil {
 		return message.ClientMessage{}, fmt.Errorf("nil message from client, discarding")
 	}
-	log.Printf("Decoded message from client with type %v\n\t\t%+v", msgType, value)
+	// Heartbeat answers are too frequent to be worth logging.
+	if msgType != "HeartbeatAck" {
+		log.Printf("Decoded message from client with type %v\n\t\t%+v", msgType, value)
+	}
 	return message.ClientMessage{
 		Type: msgType,
 		Data: value,
@@ -552,57 +791,46 @@ func EncodeServerMessage(msg interface{}) message.ServerMessage {
 	}
 }
 
-// MessageAll schedules a message to be sent to all clients asynchronously.
-// msg should not be modified after calling this function.
-func (s *Server) MessageAll(msg message.ServerMessage) {
-	s.sessionManager.messageAll(msg)
-}
-
-// MessageHost schedules a message to be sent to the host client asynchronously.
-// msg should not be modified after calling this function.
-func (s *Server) MessageHost(msg message.ServerMessage) {
-	s.sessionManager.messageHost(msg)
-}
-
-// MessageAll schedules a message to be sent to all player clients
-// asynchronously. msg should not be modified after calling this function.
-func (s *Server) MessagePlayers(msg message.ServerMessage) {
-	s.sessionManager.messagePlayers(msg)
-}
-
-// MessagePlayer schedules a message to be sent to the client named by name
-// asynchronously. msg should not be modified after calling this function.
-func (s *Server) MessagePlayer(msg message.ServerMessage, name string) {
-	s.sessionManager.messagePlayer(msg, name)
-}
-
 // MessageDitor schedules a message to be sent to the client named by name
 // asynchronously. msg should not be modified after calling this function.
 func (s *Server) MessageEditor(msg message.ServerMessage, name string) {
 	s.sessionManager.messageEditor(msg, name)
 }
 
+// MessageEditors schedules a message to be sent to every connected editor
+// asynchronously. msg should not be modified after calling this function.
+func (s *Server) MessageEditors(msg message.ServerMessage) {
+	s.sessionManager.messageEditors(msg)
+}
+
 // New creates the server that handles all of the communication for the game,
 // including serving the pages for logging in, static content, and hosting the
 // websocket gameplay. The server processes messages and passes them to other
 // parts of the program as messages. As such, a ListenerManager is provided by
 // reference from the other parts of the program, to allow other aspects to
-// register event listeners.
-func New(staticPath, passcode string, port int, globalLm *ListenerManager, gameLm *ListenerManager, editorLm *ListenerManager) *Server {
+// register event listeners. Each game room has its own listeners, which are
+// set up by the function passed to SetRoomInitializer. Clients sign in with
+// the passcodes in creds.
+func New(staticPath string, creds Credentials, port int, editorLm *ListenerManager) *Server {
 	server := &Server{
-		port:     port,
-		passcode: passcode,
+		port:        port,
+		credentials: creds,
 		sessionManager: SessionManager{
 			sessions:        make(map[SessionID]SessionVar),
 			connections:     make(map[SessionID]*Connection),
-			names:           make(map[string]SessionID),
+			names:           make(map[roomName]SessionID),
 			recentlyDropped: make(map[SessionID]time.Time),
 			editorSessions:  make(map[SessionID]SessionVar),
+			revoked:         make(map[SessionID]time.Time),
+			store:           NewMemorySessionStore(),
 		},
-		globalListenerManager: globalLm,
-		gameListenerManager:   gameLm,
 		editorListenerMangaer: editorLm,
+		rooms:                 make(map[string]*Room),
+		authLimiter:           newAuthLimiter(),
+		heartbeatInterval:     defaultHeartbeatInterval,
+		heartbeatTimeout:      defaultHeartbeatTimeout,
 	}
+	server.ctx, server.cancel = context.WithCancel(context.Background())
 
 	server.distDir = http.Dir(staticPath)
 
@@ -612,9 +840,164 @@ func New(staticPath, passcode string, port int, globalLm *ListenerManager, gameL
 	server.mux.Handle("/ws/game", websocket.Handler(server.playerInteractiveHandler))
 	server.mux.Handle("/ws/editor", websocket.Handler(server.editorInteractiveHandler))
 	//server.mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(staticPath))))
+
+	if key, err := NewTokenKey(); err != nil {
+		log.Printf("Tokens are disabled: %v", err)
+	} else {
+		server.tokens = &tokenSigner{key: key}
+	}
+
+	go server.reapSessions()
 	return server
 }
 
-func (s *Server) ListenAndServe() error {
-	return http.ListenAndServe(":"+strconv.Itoa(s.port), s.mux)
+// UseTokenKey signs tokens with key from now on, instead of the random key
+// the server starts with. Tokens signed with the old key stop working.
+func (s *Server) UseTokenKey(key []byte) error {
+	if len(key) != tokenKeySize {
+		return fmt.Errorf("token key is %v bytes, want %v", len(key), tokenKeySize)
+	}
+	s.tokens = &tokenSigner{key: key}
+	return nil
+}
+
+// UseSessionStore keeps sessions in store from now on, so that players can
+// rejoin with their existing cookies after a restart if the store is
+// persistent. If restore is set, unexpired sessions already in the store are
+// loaded and the rooms they belong to are reopened, so the room initializer
+// must already be set. Otherwise the store is emptied.
+func (s *Server) UseSessionStore(store SessionStore, restore bool) error {
+	if err := s.sessionManager.useStore(store, restore); err != nil {
+		return err
+	}
+	if !restore {
+		return nil
+	}
+	for _, code := range s.sessionManager.rooms() {
+		if _, err := s.CreateRoom(code); err != nil {
+			log.Printf("Could not reopen room %v: %v", code, err)
+		}
+	}
+	return nil
+}
+
+// reapSessions periodically removes expired sessions, and forgets old failed
+// authentication attempts, until the server shuts down.
+func (s *Server) reapSessions() {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.sessionManager.reap(time.Now())
+			s.authLimiter.reap()
+		}
+	}
+}
+
+// endSession ends a session, disconnecting its client if it's connected.
+// notice is sent to the client first, to tell it why.
+func (s *Server) endSession(id SessionID, notice message.ServerMessage) {
+	// Tell the client why it's being disconnected before the socket closes.
+	if c, ok := s.sessionManager.connection(id); ok {
+		if err := sendNotice(c, notice, time.Now().Add(noticeTimeout)); err != nil {
+			log.Printf("Failed to tell client why its session ended: %v", err)
+		}
+	}
+
+	vars, connected := s.sessionManager.DestroySession(id)
+	if connected {
+		for _, lm := range s.listenersFor(vars) {
+			lm.dispatchLeave(vars.name, vars.host, vars.spectator)
+		}
+	}
+	log.Printf("Ended session of %v", vars.name)
+}
+
+// SetCookieOptions sets the attributes of session cookies set from now on.
+func (s *Server) SetCookieOptions(opts CookieOptions) {
+	s.sessionManager.mu.Lock()
+	defer s.sessionManager.mu.Unlock()
+	s.sessionManager.cookieOptions = opts
+}
+
+// ListenOptions configures where and how the server listens for connections.
+type ListenOptions struct {
+	// Host is the address to listen on. If it's empty, the server listens on
+	// every address.
+	Host string
+	// CertFile and KeyFile are the paths of the certificate and key to serve
+	// TLS with. If they're empty, the server serves plain HTTP.
+	CertFile string
+	KeyFile  string
+}
+
+// TLS returns whether the server serves TLS with these options.
+func (o ListenOptions) TLS() bool {
+	return o.CertFile != "" || o.KeyFile != ""
+}
+
+// ListenAndServe serves clients until the server fails, or Shutdown is called,
+// in which case it returns http.ErrServerClosed.
+func (s *Server) ListenAndServe(opts ListenOptions) error {
+	s.httpServer = &http.Server{
+		Addr:    net.JoinHostPort(opts.Host, strconv.Itoa(s.port)),
+		Handler: s.mux,
+	}
+	go s.reportLatencies()
+	if opts.TLS() {
+		return s.httpServer.ListenAndServeTLS(opts.CertFile, opts.KeyFile)
+	}
+	return s.httpServer.ListenAndServe()
+}
+
+// Shutdown stops the server gracefully. Every client is told the server is
+// shutting down, then each room's shutdown hooks are run so games can be
+// saved, before the connections are closed. It waits for the connections to
+// close and for in-flight requests to finish until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	notice := EncodeServerMessage(&message.ServerShutdown{})
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(noticeTimeout)
+	}
+	// The notices are sent without holding the session lock, so clients that
+	// are slow to read can't stall everything else until the deadline.
+	for _, c := range s.sessionManager.allConnections() {
+		if err := sendNotice(c, notice, deadline); err != nil {
+			log.Printf("Failed to tell client the server is shutting down: %v", err)
+		}
+	}
+
+	s.roomsMu.RLock()
+	for _, r := range s.rooms {
+		r.shutdown()
+	}
+	s.roomsMu.RUnlock()
+
+	// Cancelling the server's context closes every connection, and turns away
+	// any that are opened from now on.
+	s.cancel()
+
+	var err error
+	if s.httpServer != nil {
+		err = s.httpServer.Shutdown(ctx)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		s.connWg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		if err == nil {
+			err = fmt.Errorf("connections still open: %w", ctx.Err())
+		}
+	}
+	return err
 }
@@ -1,8 +1,10 @@
 package server
 
 import (
+	"context"
 	"crypto/rand"
 	"fmt"
+	"log"
 	"math/big"
 	"net/http"
 	"strconv"
@@ -11,41 +13,213 @@ import (
 	"time"
 
 	"github.com/baconstrip/kiken/message"
+	"github.com/baconstrip/kiken/util"
 	"golang.org/x/net/websocket"
 )
 
 type SessionID uint64
 
+const (
+	// sessionLifetime is how long a session lasts after it's created, on both
+	// the server and in the client's cookie.
+	sessionLifetime = 24 * time.Hour
+	// recentlyDroppedWindow is how long after a connection drops that another
+	// drop is considered a duplicate.
+	recentlyDroppedWindow = 10 * time.Second
+)
+
 type SessionManager struct {
 	mu sync.RWMutex
 
 	sessions map[SessionID]SessionVar
-	names    map[string]SessionID
+	names    map[roomName]SessionID
 
 	editorSessions map[SessionID]SessionVar
 
 	connections     map[SessionID]*Connection
 	recentlyDropped map[SessionID]time.Time
+	// revoked maps the sessions that were destroyed before they expired to
+	// when they would have, so that tokens issued for them are refused until
+	// they expire on their own.
+	revoked map[SessionID]time.Time
+
+	// store keeps sessions so they can be restored after a restart.
+	store SessionStore
+	// cookieOptions are the attributes of the session cookies it sets.
+	cookieOptions CookieOptions
+}
+
+// CookieOptions are the security attributes of session cookies.
+type CookieOptions struct {
+	// Secure cookies are only sent over HTTPS.
+	Secure bool
+	// HTTPOnly cookies can't be read by scripts in the page.
+	HTTPOnly bool
+	// SameSite controls whether cookies are sent with requests from other
+	// sites.
+	SameSite http.SameSite
+}
+
+// roomName identifies a user by their name within a room, since the same name
+// may be used in different rooms.
+type roomName struct {
+	room string
+	name string
 }
 
 type Connection struct {
 	in  chan message.ClientMessage
 	out chan message.ServerMessage
 	soc *websocket.Conn
+
+	// ctx is done once the connection is dropped, or the server is shutting
+	// down, to stop the goroutines serving it.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	hb heartbeat
 }
 
 type SessionVar struct {
-	name      string
-	passcode  string
-	host      bool
-	editor    bool
-	spectator bool
+	name string
+	// room is the code of the room the session belongs to, empty for editors.
+	room string
+	// passcodeHash is the salted hash of the player's passcode, made by
+	// util.HashPasscode.
+	passcodeHash string
+	host         bool
+	editor       bool
+	spectator    bool
+	expires      time.Time
+	// addr is the address the client signed in from. It isn't stored, so
+	// it's empty for restored sessions.
+	addr string
+}
+
+// expired returns whether the session has passed its expiry time.
+func (v SessionVar) expired(now time.Time) bool {
+	return now.After(v.expires)
+}
+
+// useStore switches to keeping sessions in store. If restore is set, the
+// unexpired sessions already in the store are loaded, otherwise the store is
+// emptied.
+func (s *SessionManager) useStore(store SessionStore, restore bool) error {
+	saved, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("could not load sessions: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = store
+
+	now := time.Now()
+	for _, p := range saved {
+		if p.Revoked {
+			if !restore || !now.Before(p.Expires) {
+				if err := store.Delete(p.ID); err != nil {
+					log.Printf("Failed to remove revoked session from store: %v", err)
+				}
+				continue
+			}
+			s.revoked[p.ID] = p.Expires
+			continue
+		}
+
+		vars := p.vars()
+		// Sessions saved before they expired on the server get a full
+		// lifetime.
+		if vars.expires.IsZero() {
+			vars.expires = now.Add(sessionLifetime)
+		}
+		if !restore || vars.expired(now) {
+			if err := store.Delete(p.ID); err != nil {
+				log.Printf("Failed to remove session from store: %v", err)
+			}
+			continue
+		}
+		// Passcodes used to be saved as they were entered.
+		if vars.passcodeHash != "" && !util.IsPasscodeHash(vars.passcodeHash) {
+			if vars.passcodeHash, err = util.HashPasscode(vars.passcodeHash); err != nil {
+				return fmt.Errorf("could not hash saved passcode: %v", err)
+			}
+			if err := store.Put(storedSession(p.ID, vars)); err != nil {
+				log.Printf("Failed to save session with hashed passcode: %v", err)
+			}
+		}
+
+		if vars.editor {
+			s.editorSessions[p.ID] = vars
+		} else {
+			// Sessions saved before rooms existed all played in one game.
+			if vars.room == "" {
+				vars.room = DefaultRoom
+			}
+			s.sessions[p.ID] = vars
+		}
+		s.names[roomName{vars.room, vars.name}] = p.ID
+	}
+
+	// Save any sessions created before the store was set.
+	for _, sessions := range []map[SessionID]SessionVar{s.sessions, s.editorSessions} {
+		for id, vars := range sessions {
+			if err := store.Put(storedSession(id, vars)); err != nil {
+				log.Printf("Failed to save session: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// rooms returns the codes of the rooms that sessions belong to.
+func (s *SessionManager) rooms() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var codes []string
+	for _, vars := range s.sessions {
+		if !seen[vars.room] {
+			seen[vars.room] = true
+			codes = append(codes, vars.room)
+		}
+	}
+	return codes
+}
+
+// get returns the vars of a session, whether it's an editor's or not, even if
+// it has expired.
+func (s *SessionManager) get(id SessionID) (SessionVar, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	vars, ok := s.sessions[id]
+	if !ok {
+		vars, ok = s.editorSessions[id]
+	}
+	return vars, ok
+}
+
+// lookup returns the vars of a session, if it exists and hasn't expired.
+func (s *SessionManager) lookup(id SessionID) (SessionVar, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	vars, ok := s.sessions[id]
+	if !ok {
+		vars, ok = s.editorSessions[id]
+	}
+	if !ok || vars.expired(time.Now()) {
+		return SessionVar{}, false
+	}
+	return vars, true
 }
 
 // createSession generates a random sessionID for a user and stores the vars
 // in an association to that ID. It writes the cookie the client needs to the
 // ResponseWriter passed as w.
-func (s *SessionManager) createSession(vars SessionVar, w http.ResponseWriter) error {
+func (s *SessionManager) createSession(vars SessionVar, w http.ResponseWriter) (SessionID, SessionVar, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -53,86 +227,228 @@ func (s *SessionManager) createSession(vars SessionVar, w http.ResponseWriter) e
 	max.SetUint64(maxUint64)
 	keyBig, err := rand.Int(rand.Reader, &max)
 	if err != nil {
-		return fmt.Errorf("failed to generate random number: %v", err)
+		return 0, SessionVar{}, fmt.Errorf("failed to generate random number: %v", err)
 	}
 
 	key := SessionID(keyBig.Uint64())
+	vars.expires = time.Now().Add(sessionLifetime)
+
+	// Signing in again replaces any session the player already had, so that
+	// only the newest one can be kicked, banned or revoked, and the others
+	// can't be used to get back in.
+	if !vars.editor {
+		for _, id := range s.sessionsNamed(vars.room, vars.name) {
+			s.destroySession(id)
+		}
+	}
 
 	if vars.editor {
 		s.editorSessions[key] = vars
 	} else {
 		s.sessions[key] = vars
 	}
-	s.names[vars.name] = key
+	s.names[roomName{vars.room, vars.name}] = key
+	if err := s.store.Put(storedSession(key, vars)); err != nil {
+		log.Printf("Failed to save session: %v", err)
+	}
+
 	cookie := http.Cookie{
-		Name:    sessionName,
-		Value:   strconv.FormatUint(uint64(key), 10),
-		Expires: time.Now().Add(time.Hour * 24),
-		Path:    "/",
+		Name:     sessionName,
+		Value:    strconv.FormatUint(uint64(key), 10),
+		Expires:  vars.expires,
+		Path:     "/",
+		Secure:   s.cookieOptions.Secure,
+		HttpOnly: s.cookieOptions.HTTPOnly,
+		SameSite: s.cookieOptions.SameSite,
 	}
 	http.SetCookie(w, &cookie)
-	return nil
+	return key, vars, nil
 }
 
-// Returns the SessionID that corresponds to the given name, or the boolean set
-// to false.
-func (s *SessionManager) IDFromName(name string) (SessionID, bool) {
+// Returns the SessionID that corresponds to the given name in a room, or the
+// boolean set to false.
+func (s *SessionManager) IDFromName(room, name string) (SessionID, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	session, ok := s.names[name]
+	session, ok := s.names[roomName{room, name}]
 	return session, ok
 }
 
-// destroySession removes all the information associated with a session,
-// including the variables and connections. Should only be called after
-// dropConnection.
-func (s *SessionManager) DestroySession(key SessionID) {
+// sessionsNamed returns the IDs of every session in room with the given name,
+// ignoring case, as names are when signing in.
+// Callers must obtain a mutex before calling.
+func (s *SessionManager) sessionsNamed(room, name string) []SessionID {
+	var ids []SessionID
+	for id, vars := range s.sessions {
+		if vars.room == room && strings.EqualFold(vars.name, name) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// IDsFromName returns the SessionIDs of every session in a room with the given
+// name, ignoring case.
+func (s *SessionManager) IDsFromName(room, name string) []SessionID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sessionsNamed(room, name)
+}
+
+// DestroySession removes all the information associated with a session,
+// including the variables and connections, and closes its socket if it's
+// connected. It returns the vars of the session that was removed, and whether
+// it was connected.
+func (s *SessionManager) DestroySession(key SessionID) (SessionVar, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.names, s.sessions[key].name)
+	return s.destroySession(key)
+}
+
+// destroySession is DestroySession without locking.
+// Callers must obtain a mutex before calling.
+func (s *SessionManager) destroySession(key SessionID) (SessionVar, bool) {
+	vars, ok := s.sessions[key]
+	if !ok {
+		vars, ok = s.editorSessions[key]
+	}
+	if !ok {
+		return SessionVar{}, false
+	}
+
+	connected := false
+	if c, ok := s.connections[key]; ok {
+		c.cancel()
+		close(c.in)
+		close(c.out)
+		c.soc.Close()
+		delete(s.connections, key)
+		connected = true
+	}
+
+	if s.names[roomName{vars.room, vars.name}] == key {
+		delete(s.names, roomName{vars.room, vars.name})
+	}
 	delete(s.sessions, key)
+	delete(s.editorSessions, key)
+	delete(s.recentlyDropped, key)
+	if vars.expired(time.Now()) {
+		if err := s.store.Delete(key); err != nil {
+			log.Printf("Failed to remove session from store: %v", err)
+		}
+		return vars, connected
+	}
+
+	// Tokens for the session are still in date, so they're refused until
+	// they aren't.
+	s.revoked[key] = vars.expires
+	if err := s.store.Put(StoredSession{ID: key, Revoked: true, Expires: vars.expires}); err != nil {
+		log.Printf("Failed to save revoked session: %v", err)
+	}
+	return vars, connected
+}
+
+// isRevoked returns whether the session with the given ID was destroyed before
+// it expired.
+func (s *SessionManager) isRevoked(id SessionID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.revoked[id]
+	return ok
+}
+
+// reap destroys sessions that have expired and aren't connected, and forgets
+// connections that dropped long enough ago that they can't be duplicates.
+func (s *SessionManager) reap(now time.Time) {
+	var expired []SessionID
+
+	s.mu.Lock()
+	for id, t := range s.recentlyDropped {
+		if now.Sub(t) >= recentlyDroppedWindow {
+			delete(s.recentlyDropped, id)
+		}
+	}
+	for _, sessions := range []map[SessionID]SessionVar{s.sessions, s.editorSessions} {
+		for id, vars := range sessions {
+			if _, connected := s.connections[id]; !connected && vars.expired(now) {
+				expired = append(expired, id)
+			}
+		}
+	}
+	for id, expires := range s.revoked {
+		if !now.Before(expires) {
+			delete(s.revoked, id)
+			if err := s.store.Delete(id); err != nil {
+				log.Printf("Failed to remove revoked session from store: %v", err)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, id := range expired {
+		s.DestroySession(id)
+	}
+	if len(expired) > 0 {
+		log.Printf("Removed %v expired sessions", len(expired))
+	}
 }
 
-func (s *SessionManager) addConnection(id SessionID, ws *websocket.Conn) {
+func (s *SessionManager) addConnection(ctx context.Context, id SessionID, ws *websocket.Conn) *Connection {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.connections[id] = &Connection{
-		soc: ws,
-		in:  make(chan message.ClientMessage, 1000),
-		out: make(chan message.ServerMessage, 1000),
+	// A client reconnecting before its old connection was dropped replaces
+	// it.
+	if old, ok := s.connections[id]; ok {
+		old.cancel()
+		close(old.in)
+		close(old.out)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	c := &Connection{
+		soc:    ws,
+		in:     make(chan message.ClientMessage, 1000),
+		out:    make(chan message.ServerMessage, 1000),
+		ctx:    ctx,
+		cancel: cancel,
 	}
+	s.connections[id] = c
 	delete(s.recentlyDropped, id)
+	return c
 }
 
 // dropConnection removes the copy of the message queues and socket associated
-// with a user from the server. It returns three values, the name of the player
-// leaving, whether or not this is handler has been called for this player
-// recently, and finally whether or not this player was a host.
-func (s *SessionManager) dropConnection(id SessionID) (string, bool, bool) {
+// with a user from the server, if conn is still their connection. It returns
+// four values, the name of the player leaving, whether or not this is handler
+// has been called for this player recently, whether or not this player was a
+// host, and finally whether conn was dropped.
+func (s *SessionManager) dropConnection(id SessionID, conn *Connection) (string, bool, bool, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	name := s.sessions[id].name
 	host := s.sessions[id].host
 
-	if c, ok := s.connections[id]; ok {
-		close(c.in)
-		close(c.out)
+	c, ok := s.connections[id]
+	if !ok || c != conn {
+		return name, false, host, false
 	}
-
+	c.cancel()
+	close(c.in)
+	close(c.out)
 	delete(s.connections, id)
 
 	retVal := true
 
 	// If they've been dropped already in the past ten seconds without
 	// rejoining, this is probably a duplicate.
-	if t, ok := s.recentlyDropped[id]; ok && time.Since(t) < 10*time.Second {
+	if t, ok := s.recentlyDropped[id]; ok && time.Since(t) < recentlyDroppedWindow {
 		retVal = false
 	}
 	s.recentlyDropped[id] = time.Now()
 
-	return name, retVal, host
+	return name, retVal, host, true
 }
 
 // withConnection locks the mutex and runs an operation. Returns an error if
@@ -149,66 +465,102 @@ func (s *SessionManager) withConnection(id SessionID, f func(*Connection) error)
 	return f(c)
 }
 
+// connection returns the connection of a session, if it's connected.
+func (s *SessionManager) connection(id SessionID) (*Connection, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.connections[id]
+	return c, ok
+}
+
+// allConnections returns every open connection.
+func (s *SessionManager) allConnections() []*Connection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conns := make([]*Connection, 0, len(s.connections))
+	for _, c := range s.connections {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
 // writeMessage schedules a message to be sent to a client asynchronously.
 // Do not modify message after scheduling. Returns an error if the client is
 // already disconnected.
 func (s *SessionManager) writeMessage(id SessionID, msg message.ServerMessage) error {
 	return s.withConnection(id, func(c *Connection) error {
-		c.out <- msg
+		c.queue(msg)
 		return nil
 	})
 }
 
-// messageAll schedules a message to be sent asynchronously to all clients.
-func (s *SessionManager) messageAll(msg message.ServerMessage) {
+// queue schedules a message to be sent over the connection by its writer. If
+// the client has fallen so far behind that its queue is full, its socket is
+// closed so that it's dropped, rather than holding up messages to everyone
+// else.
+func (c *Connection) queue(msg message.ServerMessage) {
+	select {
+	case c.out <- msg:
+	default:
+		log.Printf("Outgoing messages backed up, closing connection")
+		c.soc.Close()
+	}
+}
+
+// messageAll schedules a message to be sent asynchronously to all clients in
+// a room.
+func (s *SessionManager) messageAll(room string, msg message.ServerMessage) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	for id := range s.connections {
-		if _, ok := s.sessions[id]; ok {
-			s.writeMessage(id, msg)
+	for id, c := range s.connections {
+		if vars, ok := s.sessions[id]; ok && vars.room == room {
+			c.queue(msg)
 		}
 	}
 }
 
-// messageHost schedules a message to be sent asynchronously to the host.
-func (s *SessionManager) messageHost(msg message.ServerMessage) {
+// messageHost schedules a message to be sent asynchronously to the host of a
+// room.
+func (s *SessionManager) messageHost(room string, msg message.ServerMessage) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	for id := range s.connections {
-		if _, ok := s.sessions[id]; ok {
-			if s.sessions[id].host {
-				s.writeMessage(id, msg)
+	for id, c := range s.connections {
+		if vars, ok := s.sessions[id]; ok && vars.room == room {
+			if vars.host {
+				c.queue(msg)
 			}
 		}
 	}
 }
 
 // messagePlayers schedules a message to be sent asynchronously to all players
-// except the host.
-func (s *SessionManager) messagePlayers(msg message.ServerMessage) {
+// in a room except the host.
+func (s *SessionManager) messagePlayers(room string, msg message.ServerMessage) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	for id := range s.connections {
-		if _, ok := s.sessions[id]; ok {
-			if !s.sessions[id].host {
-				s.writeMessage(id, msg)
+	for id, c := range s.connections {
+		if vars, ok := s.sessions[id]; ok && vars.room == room {
+			if !vars.host {
+				c.queue(msg)
 			}
 		}
 	}
 }
 
 // messagePlayer schedules a message to be sent asynchronously to a single
-// player, whose name is given.
-func (s *SessionManager) messagePlayer(msg message.ServerMessage, name string) {
+// player in a room, whose name is given.
+func (s *SessionManager) messagePlayer(room string, msg message.ServerMessage, name string) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	for id := range s.connections {
-		if _, ok := s.sessions[id]; ok {
-			if s.sessions[id].name == name {
-				s.writeMessage(id, msg)
+	for id, c := range s.connections {
+		if vars, ok := s.sessions[id]; ok && vars.room == room {
+			if vars.name == name {
+				c.queue(msg)
 				return
 			}
 		}
@@ -220,19 +572,36 @@ func (s *SessionManager) messageEditor(msg message.ServerMessage, name string) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	for id := range s.editorSessions {
-		if s.sessions[id].name == name {
-			s.writeMessage(id, msg)
+	for id, vars := range s.editorSessions {
+		if vars.name == name {
+			if c, ok := s.connections[id]; ok {
+				c.queue(msg)
+			}
 			return
 		}
 	}
 }
 
-func (s *SessionManager) userExists(name string, caseInsensitive bool) bool {
+// messageEditors will message every editor user.
+func (s *SessionManager) messageEditors(msg message.ServerMessage) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for id := range s.editorSessions {
+		if c, ok := s.connections[id]; ok {
+			c.queue(msg)
+		}
+	}
+}
+
+func (s *SessionManager) userExists(room, name string, caseInsensitive bool) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	for _, vars := range s.sessions {
+		if vars.room != room {
+			continue
+		}
 		if vars.name == name || (strings.EqualFold(name, vars.name) && caseInsensitive) {
 			return true
 		}
@@ -240,14 +609,21 @@ func (s *SessionManager) userExists(name string, caseInsensitive bool) bool {
 	return false
 }
 
-func (s *SessionManager) correctPasscode(name string, caseInsensitive bool, passcode string) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (s *SessionManager) correctPasscode(room, name string, caseInsensitive bool, passcode string) bool {
+	hash, found := "", false
 
+	s.mu.RLock()
 	for _, vars := range s.sessions {
+		if vars.room != room {
+			continue
+		}
 		if vars.name == name || (strings.EqualFold(name, vars.name) && caseInsensitive) {
-			return vars.passcode == passcode
+			hash, found = vars.passcodeHash, true
+			break
 		}
 	}
-	return false
+	s.mu.RUnlock()
+
+	// Hashing is slow on purpose, so it's done without holding the lock.
+	return found && util.CheckPasscode(hash, passcode)
 }
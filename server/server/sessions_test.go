@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baconstrip/kiken/message"
+	"golang.org/x/net/websocket"
+)
+
+// connectTestClients signs n players into room on s, connects each of them to
+// the game websocket of srv, and returns their sockets once they're all being
+// served. The players are named player0 onwards in every room.
+func connectTestClients(tb testing.TB, s *Server, srv *httptest.Server, room string, n int) []*websocket.Conn {
+	tb.Helper()
+
+	s.sessionManager.mu.RLock()
+	existing := len(s.sessionManager.connections)
+	s.sessionManager.mu.RUnlock()
+
+	var clients []*websocket.Conn
+	for i := 0; i < n; i++ {
+		rec := httptest.NewRecorder()
+		if _, _, err := s.sessionManager.createSession(SessionVar{name: fmt.Sprintf("player%v", i), room: room}, rec); err != nil {
+			tb.Fatalf("createSession() failed: %v", err)
+		}
+
+		url := strings.Replace(srv.URL, "http", "ws", 1) + "/ws/game"
+		config, err := websocket.NewConfig(url, srv.URL)
+		if err != nil {
+			tb.Fatalf("NewConfig() failed: %v", err)
+		}
+		config.Header.Set("Cookie", rec.Result().Cookies()[0].String())
+		ws, err := websocket.DialConfig(config)
+		if err != nil {
+			tb.Fatalf("DialConfig() failed: %v", err)
+		}
+		clients = append(clients, ws)
+	}
+
+	// Wait for the server to register every connection, so that none miss
+	// the first message.
+	for {
+		s.sessionManager.mu.RLock()
+		connected := len(s.sessionManager.connections)
+		s.sessionManager.mu.RUnlock()
+		if connected == existing+n {
+			return clients
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// BenchmarkMessageAll measures how long a message sent with MessageAll takes to
+// reach every client in a room.
+func BenchmarkMessageAll(b *testing.B) {
+	for _, n := range []int{10, 100, 500} {
+		b.Run(fmt.Sprintf("clients=%v", n), func(b *testing.B) {
+			// Every message sent is logged, which would swamp the benchmark.
+			log.SetOutput(io.Discard)
+			defer log.SetOutput(os.Stderr)
+
+			s := New("", Credentials{}, 0, NewListenerManager())
+			room, err := s.CreateRoom(DefaultRoom)
+			if err != nil {
+				b.Fatalf("CreateRoom() failed: %v", err)
+			}
+			srv := httptest.NewServer(s.mux)
+			defer srv.Close()
+			defer s.cancel()
+
+			clients := connectTestClients(b, s, srv, room.Code(), n)
+			received := make(chan struct{}, n)
+			for _, ws := range clients {
+				go func(ws *websocket.Conn) {
+					for {
+						var msg string
+						if err := websocket.Message.Receive(ws, &msg); err != nil {
+							return
+						}
+						received <- struct{}{}
+					}
+				}(ws)
+			}
+
+			msg := EncodeServerMessage(&message.HostAdd{Name: "host"})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				room.MessageAll(msg)
+				for j := 0; j < n; j++ {
+					<-received
+				}
+			}
+			b.StopTimer()
+
+			for _, ws := range clients {
+				ws.Close()
+			}
+		})
+	}
+}
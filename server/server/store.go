@@ -0,0 +1,223 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/baconstrip/kiken/util"
+)
+
+// StoredSession is a session as kept by a SessionStore.
+type StoredSession struct {
+	ID   SessionID
+	Name string
+	Room string
+	// Passcode is the salted hash of the player's passcode.
+	Passcode  string
+	Host      bool
+	Editor    bool
+	Spectator bool
+	Expires   time.Time
+	// Revoked is set if the session was destroyed before it expired. Only
+	// its ID and expiry are kept, so that tokens issued for it can be
+	// refused.
+	Revoked bool `json:",omitempty"`
+}
+
+func (p StoredSession) vars() SessionVar {
+	return SessionVar{
+		name:         p.Name,
+		room:         p.Room,
+		passcodeHash: p.Passcode,
+		host:         p.Host,
+		editor:       p.Editor,
+		spectator:    p.Spectator,
+		expires:      p.Expires,
+	}
+}
+
+func storedSession(id SessionID, vars SessionVar) StoredSession {
+	return StoredSession{
+		ID:        id,
+		Name:      vars.name,
+		Room:      vars.room,
+		Passcode:  vars.passcodeHash,
+		Host:      vars.host,
+		Editor:    vars.editor,
+		Spectator: vars.spectator,
+		Expires:   vars.expires,
+	}
+}
+
+// SessionStore keeps sessions somewhere they can be loaded from when the
+// server starts. The SessionManager keeps its own copy of every session, so a
+// store is only read at startup.
+type SessionStore interface {
+	// Load returns every session in the store.
+	Load() ([]StoredSession, error)
+	// Put adds a session to the store, replacing any with the same ID.
+	Put(session StoredSession) error
+	// Delete removes the session with the given ID from the store, if it's
+	// there.
+	Delete(id SessionID) error
+}
+
+// MemorySessionStore is a SessionStore that keeps sessions in memory, so they
+// don't survive a restart.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[SessionID]StoredSession
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[SessionID]StoredSession),
+	}
+}
+
+func (m *MemorySessionStore) Load() ([]StoredSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sessions []StoredSession
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+func (m *MemorySessionStore) Put(session StoredSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *MemorySessionStore) Delete(id SessionID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+// FileSessionStore is a SessionStore that saves sessions to a file in the
+// background whenever they change, so that the SessionManager never waits on
+// the disk while holding its mutex. Flush waits for the file to be up to date.
+type FileSessionStore struct {
+	memory *MemorySessionStore
+	path   string
+
+	// pending is set while a save has been started in the background but
+	// hasn't yet taken its copy of the sessions. It's guarded by the memory
+	// store's mutex.
+	pending bool
+	// saveMu is held while saving, so that saves are made one at a time, and
+	// an older copy of the sessions never replaces a newer one.
+	saveMu sync.Mutex
+}
+
+// NewFileSessionStore creates a FileSessionStore that saves to the file at
+// path, loading any sessions already saved there.
+func NewFileSessionStore(path string) (*FileSessionStore, error) {
+	f := &FileSessionStore{
+		memory: NewMemorySessionStore(),
+		path:   path,
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read saved sessions: %v", err)
+	}
+
+	var saved []StoredSession
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("could not decode saved sessions: %v", err)
+	}
+	for _, s := range saved {
+		f.memory.sessions[s.ID] = s
+	}
+	return f, nil
+}
+
+// Flush writes every session to the file, and waits for it to be written.
+func (f *FileSessionStore) Flush() error {
+	return f.save(false)
+}
+
+// save writes every session to the file. If onlyPending is set, they're only
+// written if they haven't been since they last changed.
+func (f *FileSessionStore) save(onlyPending bool) error {
+	f.saveMu.Lock()
+	defer f.saveMu.Unlock()
+
+	f.memory.mu.Lock()
+	if onlyPending && !f.pending {
+		f.memory.mu.Unlock()
+		return nil
+	}
+	f.pending = false
+	var saved []StoredSession
+	for _, s := range f.memory.sessions {
+		saved = append(saved, s)
+	}
+	f.memory.mu.Unlock()
+
+	// Keep the file stable between saves, so it's easier to inspect.
+	sort.Slice(saved, func(i, j int) bool { return saved[i].ID < saved[j].ID })
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("could not encode sessions: %v", err)
+	}
+	return util.WriteFileAtomic(f.path, data, 0o600)
+}
+
+// saveLater saves the sessions in the background. Changes made before an
+// earlier save takes its copy of the sessions are saved together.
+// Callers must hold the memory store's mutex.
+func (f *FileSessionStore) saveLater() {
+	if f.pending {
+		return
+	}
+	f.pending = true
+	go func() {
+		if err := f.save(true); err != nil {
+			log.Printf("Failed to save sessions: %v", err)
+		}
+	}()
+}
+
+func (f *FileSessionStore) Load() ([]StoredSession, error) {
+	return f.memory.Load()
+}
+
+func (f *FileSessionStore) Put(session StoredSession) error {
+	f.memory.mu.Lock()
+	defer f.memory.mu.Unlock()
+
+	f.memory.sessions[session.ID] = session
+	f.saveLater()
+	return nil
+}
+
+func (f *FileSessionStore) Delete(id SessionID) error {
+	f.memory.mu.Lock()
+	defer f.memory.mu.Unlock()
+
+	if _, ok := f.memory.sessions[id]; !ok {
+		return nil
+	}
+	delete(f.memory.sessions, id)
+	f.saveLater()
+	return nil
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestSessionManager() *SessionManager {
+	return &SessionManager{
+		sessions:        make(map[SessionID]SessionVar),
+		connections:     make(map[SessionID]*Connection),
+		names:           make(map[roomName]SessionID),
+		recentlyDropped: make(map[SessionID]time.Time),
+		editorSessions:  make(map[SessionID]SessionVar),
+		revoked:         make(map[SessionID]time.Time),
+		store:           NewMemorySessionStore(),
+	}
+}
+
+func TestFileSessionStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := NewFileSessionStore(path)
+	if err != nil {
+		t.Fatalf("NewFileSessionStore() of a missing file failed: %v", err)
+	}
+
+	expires := time.Now().Add(time.Hour).Round(0).UTC()
+	kept := StoredSession{ID: 1, Name: "kept", Room: "alpha", Passcode: "x", Expires: expires}
+	if err := store.Put(kept); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if err := store.Put(StoredSession{ID: 2, Name: "deleted", Room: "alpha", Expires: expires}); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if err := store.Delete(2); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+
+	reopened, err := NewFileSessionStore(path)
+	if err != nil {
+		t.Fatalf("NewFileSessionStore() failed: %v", err)
+	}
+	got, err := reopened.Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if want := []StoredSession{kept}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
+
+func TestUseStoreSkipsExpired(t *testing.T) {
+	store := NewMemorySessionStore()
+	store.Put(StoredSession{ID: 1, Name: "fresh", Room: "alpha", Expires: time.Now().Add(time.Hour)})
+	store.Put(StoredSession{ID: 2, Name: "stale", Room: "alpha", Expires: time.Now().Add(-time.Hour)})
+
+	s := newTestSessionManager()
+	if err := s.useStore(store, true); err != nil {
+		t.Fatalf("useStore() failed: %v", err)
+	}
+	if _, ok := s.lookup(1); !ok {
+		t.Errorf("unexpired session wasn't restored")
+	}
+	if _, ok := s.lookup(2); ok {
+		t.Errorf("expired session was restored")
+	}
+	if saved, _ := store.Load(); len(saved) != 1 {
+		t.Errorf("store has %v sessions after restoring, want 1", len(saved))
+	}
+}
+
+func TestReap(t *testing.T) {
+	s := newTestSessionManager()
+	now := time.Now()
+	s.sessions[1] = SessionVar{name: "fresh", room: "alpha", expires: now.Add(time.Hour)}
+	s.sessions[2] = SessionVar{name: "stale", room: "alpha", expires: now.Add(-time.Hour)}
+	s.names[roomName{"alpha", "fresh"}] = 1
+	s.names[roomName{"alpha", "stale"}] = 2
+	s.recentlyDropped[1] = now.Add(-time.Minute)
+	s.recentlyDropped[3] = now
+
+	s.reap(now)
+
+	if _, ok := s.sessions[1]; !ok {
+		t.Errorf("reap() removed an unexpired session")
+	}
+	if _, ok := s.sessions[2]; ok {
+		t.Errorf("reap() kept an expired session")
+	}
+	if _, ok := s.IDFromName("alpha", "stale"); ok {
+		t.Errorf("reap() kept the name of an expired session")
+	}
+	if _, ok := s.recentlyDropped[1]; ok {
+		t.Errorf("reap() kept an old recently dropped entry")
+	}
+	if _, ok := s.recentlyDropped[3]; !ok {
+		t.Errorf("reap() removed a recent recently dropped entry")
+	}
+}
+
+func TestUseStoreHashesPlaintextPasscodes(t *testing.T) {
+	store := NewMemorySessionStore()
+	store.Put(StoredSession{ID: 1, Name: "player", Room: "alpha", Passcode: "hunter2", Expires: time.Now().Add(time.Hour)})
+
+	s := newTestSessionManager()
+	if err := s.useStore(store, true); err != nil {
+		t.Fatalf("useStore() failed: %v", err)
+	}
+	if !s.correctPasscode("alpha", "player", false, "hunter2") {
+		t.Errorf("correctPasscode() rejected the saved passcode")
+	}
+	if s.correctPasscode("alpha", "player", false, "hunter3") {
+		t.Errorf("correctPasscode() accepted the wrong passcode")
+	}
+	saved, _ := store.Load()
+	if len(saved) != 1 || saved[0].Passcode == "hunter2" {
+		t.Errorf("store still has the plaintext passcode: %+v", saved)
+	}
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/baconstrip/kiken/util"
+)
+
+const (
+	// tokenKeySize is the size of the keys tokens are signed with.
+	tokenKeySize = 32
+	// tokenQueryParam is the query parameter a token can be given in, for
+	// clients that can't set headers on websocket requests.
+	tokenQueryParam = "token"
+)
+
+// Roles a session can have, as carried by its token.
+const (
+	roleHost      = "host"
+	rolePlayer    = "player"
+	roleSpectator = "spectator"
+	roleEditor    = "editor"
+)
+
+// tokenClaims is what a token says about the session it was issued for.
+type tokenClaims struct {
+	ID      SessionID
+	Name    string
+	Room    string
+	Role    string
+	Expires int64
+}
+
+// vars returns the vars of the session the token was issued for. Only what's
+// needed to serve the session is carried by the token, so the passcode hash
+// and address are left empty.
+func (c tokenClaims) vars() SessionVar {
+	return SessionVar{
+		name:      c.Name,
+		room:      c.Room,
+		host:      c.Role == roleHost,
+		editor:    c.Role == roleEditor,
+		spectator: c.Role == roleSpectator,
+		expires:   time.Unix(c.Expires, 0),
+	}
+}
+
+// role returns the role of a session, as carried by its token.
+func (vars SessionVar) role() string {
+	switch {
+	case vars.editor:
+		return roleEditor
+	case vars.host:
+		return roleHost
+	case vars.spectator:
+		return roleSpectator
+	default:
+		return rolePlayer
+	}
+}
+
+// tokenSigner issues and checks tokens, which are signed with HMAC-SHA256 so
+// that the claims in them can be trusted without keeping a copy of each one. A
+// nil tokenSigner issues no tokens and accepts none.
+type tokenSigner struct {
+	key []byte
+}
+
+// NewTokenKey generates a random key to sign tokens with.
+func NewTokenKey() ([]byte, error) {
+	key := make([]byte, tokenKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate token key: %v", err)
+	}
+	return key, nil
+}
+
+// LoadTokenKey reads the key saved at path, or generates one and saves it
+// there if there is none, so that tokens stay valid across restarts.
+func LoadTokenKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != tokenKeySize {
+			return nil, fmt.Errorf("token key in %v is %v bytes, want %v", path, len(key), tokenKeySize)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read token key: %v", err)
+	}
+
+	key, err = NewTokenKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := util.WriteFileAtomic(path, key, 0o600); err != nil {
+		return nil, fmt.Errorf("could not save token key: %v", err)
+	}
+	return key, nil
+}
+
+// sign issues a token for the session with the given ID and vars, which
+// expires when the session does.
+func (t *tokenSigner) sign(id SessionID, vars SessionVar) (string, error) {
+	if t == nil {
+		return "", fmt.Errorf("tokens are not enabled")
+	}
+
+	payload, err := json.Marshal(tokenClaims{
+		ID:      id,
+		Name:    vars.name,
+		Room:    vars.room,
+		Role:    vars.role(),
+		Expires: vars.expires.Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token: %v", err)
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(t.mac(payload)), nil
+}
+
+// verify checks that token was issued by this server and hasn't expired, and
+// returns its claims.
+func (t *tokenSigner) verify(token string, now time.Time) (tokenClaims, error) {
+	if t == nil {
+		return tokenClaims{}, fmt.Errorf("tokens are not enabled")
+	}
+
+	enc := base64.RawURLEncoding
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return tokenClaims{}, fmt.Errorf("malformed token")
+	}
+	payload, err := enc.DecodeString(parts[0])
+	if err != nil {
+		return tokenClaims{}, fmt.Errorf("malformed token: %v", err)
+	}
+	mac, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return tokenClaims{}, fmt.Errorf("malformed token: %v", err)
+	}
+	if !hmac.Equal(mac, t.mac(payload)) {
+		return tokenClaims{}, fmt.Errorf("bad token signature")
+	}
+
+	var claims tokenClaims
+	d := json.NewDecoder(bytes.NewReader(payload))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&claims); err != nil {
+		return tokenClaims{}, fmt.Errorf("malformed token: %v", err)
+	}
+	if !now.Before(time.Unix(claims.Expires, 0)) {
+		return tokenClaims{}, fmt.Errorf("token expired")
+	}
+	return claims, nil
+}
+
+func (t *tokenSigner) mac(payload []byte) []byte {
+	m := hmac.New(sha256.New, t.key)
+	m.Write(payload)
+	return m.Sum(nil)
+}
+
+// requestToken returns the token a request was made with, from either its
+// Authorization header or its query, or an empty string if it has none.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		const prefix = "Bearer "
+		if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+			return strings.TrimSpace(auth[len(prefix):])
+		}
+		return ""
+	}
+	return r.URL.Query().Get(tokenQueryParam)
+}
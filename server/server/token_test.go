@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	key, err := NewTokenKey()
+	if err != nil {
+		t.Fatalf("NewTokenKey() failed: %v", err)
+	}
+	signer := &tokenSigner{key: key}
+	now := time.Now()
+	vars := SessionVar{name: "player", room: "alpha", spectator: true, expires: now.Add(time.Hour)}
+
+	token, err := signer.sign(42, vars)
+	if err != nil {
+		t.Fatalf("sign() failed: %v", err)
+	}
+	claims, err := signer.verify(token, now)
+	if err != nil {
+		t.Fatalf("verify() failed: %v", err)
+	}
+	want := tokenClaims{ID: 42, Name: "player", Room: "alpha", Role: roleSpectator, Expires: vars.expires.Unix()}
+	if claims != want {
+		t.Errorf("verify() = %+v, want %+v", claims, want)
+	}
+
+	if _, err := signer.verify(token, now.Add(2*time.Hour)); err == nil {
+		t.Errorf("verify() accepted an expired token")
+	}
+	other, _ := NewTokenKey()
+	if _, err := (&tokenSigner{key: other}).verify(token, now); err == nil {
+		t.Errorf("verify() accepted a token signed with another key")
+	}
+	tampered := []byte(token)
+	tampered[3] ^= 1
+	if _, err := signer.verify(string(tampered), now); err == nil {
+		t.Errorf("verify() accepted a tampered token")
+	}
+}
+
+func TestVerifyTokenIsStateless(t *testing.T) {
+	s := New("", Credentials{}, 0, nil)
+	vars := SessionVar{name: "player", room: "alpha", expires: time.Now().Add(time.Hour)}
+	token, err := s.tokens.sign(42, vars)
+	if err != nil {
+		t.Fatalf("sign() failed: %v", err)
+	}
+
+	// The token is trusted from its claims, without the session being looked
+	// up.
+	id, got, err := s.verifyToken(token)
+	if err != nil {
+		t.Fatalf("verifyToken() failed: %v", err)
+	}
+	if id != 42 || got.name != "player" || got.room != "alpha" || got.host || got.spectator || got.editor {
+		t.Errorf("verifyToken() = %v, %+v, want the session of player in alpha", id, got)
+	}
+
+	// Until it expires, a token is refused once its session is destroyed, even
+	// after a restart.
+	s.sessionManager.sessions[42] = vars
+	s.sessionManager.DestroySession(42)
+	if _, _, err := s.verifyToken(token); err == nil {
+		t.Errorf("verifyToken() accepted the token of a destroyed session")
+	}
+	restarted := newTestSessionManager()
+	if err := restarted.useStore(s.sessionManager.store, true); err != nil {
+		t.Fatalf("useStore() failed: %v", err)
+	}
+	if !restarted.isRevoked(42) {
+		t.Errorf("revoked session wasn't revoked after restoring")
+	}
+	if _, ok := restarted.lookup(42); ok {
+		t.Errorf("revoked session was restored as a session")
+	}
+
+	restarted.reap(vars.expires.Add(time.Second))
+	if restarted.isRevoked(42) {
+		t.Errorf("reap() kept a revoked session past its expiry")
+	}
+	if saved, _ := restarted.store.Load(); len(saved) != 0 {
+		t.Errorf("store has %v sessions after reaping, want 0", len(saved))
+	}
+}
+
+func TestLoadTokenKeyPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.key")
+	first, err := LoadTokenKey(path)
+	if err != nil {
+		t.Fatalf("LoadTokenKey() of a missing file failed: %v", err)
+	}
+	second, err := LoadTokenKey(path)
+	if err != nil {
+		t.Fatalf("LoadTokenKey() failed: %v", err)
+	}
+	if string(first) != string(second) {
+		t.Errorf("LoadTokenKey() returned a different key after saving one")
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	r := httptest.NewRequest("GET", "/ws/game?token=query", nil)
+	if got := requestToken(r); got != "query" {
+		t.Errorf("requestToken() from query = %q, want %q", got, "query")
+	}
+	r.Header.Set("Authorization", "Bearer header")
+	if got := requestToken(r); got != "header" {
+		t.Errorf("requestToken() from header = %q, want %q", got, "header")
+	}
+	r.Header.Set("Authorization", "Basic abc")
+	if got := requestToken(r); got != "" {
+		t.Errorf("requestToken() with another scheme = %q, want none", got)
+	}
+}
@@ -0,0 +1,80 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	passcodeHashScheme = "pbkdf2-sha256"
+	passcodeIterations = 100000
+	passcodeSaltSize   = 16
+)
+
+// HashPasscode derives a salted hash of passcode with PBKDF2, encoded along
+// with its parameters so that it can be checked by CheckPasscode.
+func HashPasscode(passcode string) (string, error) {
+	salt := make([]byte, passcodeSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %v", err)
+	}
+
+	key := pbkdf2.Key([]byte(passcode), salt, passcodeIterations, sha256.Size, sha256.New)
+	return strings.Join([]string{
+		passcodeHashScheme,
+		strconv.Itoa(passcodeIterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$"), nil
+}
+
+// IsPasscodeHash returns whether hash was produced by HashPasscode.
+func IsPasscodeHash(hash string) bool {
+	_, _, _, err := parsePasscodeHash(hash)
+	return err == nil
+}
+
+// CheckPasscode returns whether passcode matches a hash produced by
+// HashPasscode, in time that doesn't depend on how much of it matches.
+func CheckPasscode(hash, passcode string) bool {
+	iterations, salt, key, err := parsePasscodeHash(hash)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, pbkdf2.Key([]byte(passcode), salt, iterations, sha256.Size, sha256.New)) == 1
+}
+
+// EqualSecrets compares two secrets in time that doesn't depend on how much of
+// them match, or on their lengths.
+func EqualSecrets(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+func parsePasscodeHash(hash string) (int, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passcodeHashScheme {
+		return 0, nil, nil, fmt.Errorf("not a passcode hash")
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return 0, nil, nil, fmt.Errorf("bad iteration count in passcode hash")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("bad salt in passcode hash: %v", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) != sha256.Size {
+		return 0, nil, nil, fmt.Errorf("bad key in passcode hash")
+	}
+	return iterations, salt, key, nil
+}
@@ -0,0 +1,87 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckPasscodeVectors(t *testing.T) {
+	// The PBKDF2-HMAC-SHA256 test vectors from RFC 7914, section 11, cut to
+	// the length of the hashes we store.
+	for _, tc := range []struct {
+		passcode string
+		hash     string
+	}{
+		{"passwd", "pbkdf2-sha256$1$c2FsdA$VawEblbjCJ/sFpHCJUS2BflBhSFt3gRl5oudV8INrLw"},
+		{"Password", "pbkdf2-sha256$80000$TmFDbA$TdzY9guYviGDDO5e8icB+WQaRBjQTAQUrv8Ih2s0q1Y"},
+	} {
+		if !CheckPasscode(tc.hash, tc.passcode) {
+			t.Errorf("CheckPasscode(%q, %q) = false, want true", tc.hash, tc.passcode)
+		}
+		if CheckPasscode(tc.hash, tc.passcode+"x") {
+			t.Errorf("CheckPasscode(%q, %q) = true, want false", tc.hash, tc.passcode+"x")
+		}
+	}
+}
+
+func TestHashPasscode(t *testing.T) {
+	hash, err := HashPasscode("secret")
+	if err != nil {
+		t.Fatalf("HashPasscode() failed: %v", err)
+	}
+	if !IsPasscodeHash(hash) {
+		t.Errorf("IsPasscodeHash(%q) = false, want true", hash)
+	}
+	if !CheckPasscode(hash, "secret") {
+		t.Errorf("CheckPasscode() of the hashed passcode = false, want true")
+	}
+	if CheckPasscode(hash, "Secret") || CheckPasscode(hash, "") {
+		t.Errorf("CheckPasscode() of a different passcode = true, want false")
+	}
+
+	again, err := HashPasscode("secret")
+	if err != nil {
+		t.Fatalf("HashPasscode() failed: %v", err)
+	}
+	if again == hash {
+		t.Errorf("HashPasscode() gave the same hash twice, the salt isn't random")
+	}
+}
+
+func TestMalformedPasscodeHash(t *testing.T) {
+	valid := "pbkdf2-sha256$1$c2FsdA$VawEblbjCJ/sFpHCJUS2BflBhSFt3gRl5oudV8INrLw"
+	for _, hash := range []string{
+		"",
+		"passwd",
+		"pbkdf2-sha256",
+		"pbkdf2-sha1$1$c2FsdA$VawEblbjCJ/sFpHCJUS2BflBhSFt3gRl5oudV8INrLw",
+		"pbkdf2-sha256$0$c2FsdA$VawEblbjCJ/sFpHCJUS2BflBhSFt3gRl5oudV8INrLw",
+		"pbkdf2-sha256$-1$c2FsdA$VawEblbjCJ/sFpHCJUS2BflBhSFt3gRl5oudV8INrLw",
+		"pbkdf2-sha256$many$c2FsdA$VawEblbjCJ/sFpHCJUS2BflBhSFt3gRl5oudV8INrLw",
+		"pbkdf2-sha256$1$not base64!$VawEblbjCJ/sFpHCJUS2BflBhSFt3gRl5oudV8INrLw",
+		"pbkdf2-sha256$1$c2FsdA$not base64!",
+		"pbkdf2-sha256$1$c2FsdA$VawEblbjCJ/sFpHCJUS2Bfl",
+		"pbkdf2-sha256$1$c2FsdA",
+		valid + "$extra",
+		strings.ToUpper(valid),
+	} {
+		if _, _, _, err := parsePasscodeHash(hash); err == nil {
+			t.Errorf("parsePasscodeHash(%q) succeeded, want an error", hash)
+		}
+		if IsPasscodeHash(hash) {
+			t.Errorf("IsPasscodeHash(%q) = true, want false", hash)
+		}
+		if CheckPasscode(hash, "passwd") {
+			t.Errorf("CheckPasscode(%q) = true, want false", hash)
+		}
+	}
+}
+
+func TestEqualSecrets(t *testing.T) {
+	if !EqualSecrets("secret", "secret") {
+		t.Errorf("EqualSecrets() of equal secrets = false, want true")
+	}
+	if EqualSecrets("secret", "secrets") || EqualSecrets("secret", "") {
+		t.Errorf("EqualSecrets() of different secrets = true, want false")
+	}
+}
@@ -43,3 +43,18 @@ func runeIsEmoji(r rune) bool {
 		(r >= 0x2B50 && r <= 0x2B50) || // Star emoji
 		(r >= 0x1F900 && r <= 0x1F9FF) // Supplemental symbols and pictographs
 }
+
+// Check if the string can be used as a room code. Room codes are short and
+// made of ASCII letters, digits, and dashes so they can be typed easily and
+// used in file names.
+func IsValidRoomCode(str string) bool {
+	if str == "" || len(str) > 32 {
+		return false
+	}
+	for _, r := range str {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}